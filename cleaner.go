@@ -3,6 +3,7 @@ package gsoup
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net/url"
 	"strings"
@@ -11,8 +12,9 @@ import (
 	"golang.org/x/net/html/atom"
 )
 
-// Cleaner defines the interface for sanitizing markup
-type Cleaner interface {
+// Sanitizer defines the interface for sanitizing markup. It is implemented by both
+// Cleaner and Policy
+type Sanitizer interface {
 	// Clean sanizitizes HTML input based on the cleaner's rules
 	Clean(io.Reader) (*html.Node, error)
 	// CleanNode sanitizes HTML in an already constructed document. NOTE: This call is
@@ -21,31 +23,191 @@ type Cleaner interface {
 	CleanNode(root *html.Node) (*html.Node, error)
 	// CleanString is a convenience wrapper for simple, string-in-string-out cleaning of markup
 	CleanString(input string) (string, error)
-	// AddTags adds acceptable tags (and their allowed attributes) to the whitelist
+	// CleanWithReport behaves like Clean but also returns a report of everything removed
+	CleanWithReport(io.Reader) (*html.Node, *Report, error)
+	// CleanFragment parses HTML input as the children of a context element (e.g. atom.Div,
+	// atom.Tbody or atom.Ul) rather than as a full document, returning the sanitized nodes.
+	// If context is zero, the input is parsed as the contents of <body>
+	CleanFragment(input io.Reader, context atom.Atom) ([]*html.Node, error)
+	// CleanTo sanitizes HTML input as it is tokenized, writing the result to w without
+	// building a DOM. Transformers are not applied. It fails with html.ErrBufferExceeded
+	// on tokens larger than 1 MiB, and its report paths omit the html and body elements
+	// the parser would imply
+	CleanTo(w io.Writer, input io.Reader) error
+	// Validate checks HTML input against the cleaner's whitelist without modifying anything.
+	// Transformers, post-transformers and finalizers are not run. If the whitelist would
+	// remove any markup, a *ValidationError listing the violations is returned
+	Validate(io.Reader) error
+}
+
+// Cleaner defines the interface for configuring and sanitizing markup. A Cleaner must not
+// be reconfigured while it is in use by other goroutines; use Compile to obtain a Policy
+// that is safe for concurrent use
+type Cleaner interface {
+	Sanitizer
+
+	// AddTags adds acceptable tags (and their allowed attributes) to the whitelist. Tagdefs
+	// without an atom are added by Name, which must be a valid custom element name. It
+	// panics if a Tagdef has neither an atom nor a valid name
 	AddTags(tags ...*Tagdef) Cleaner
 	// RemoveTags removes tags that should be deleted during sanitization
 	RemoveTags(tags ...atom.Atom) Cleaner
+	// RemoveTagNames removes tags by name, including custom elements
+	RemoveTagNames(names ...string) Cleaner
 	// PreserveChildren causes child nodes of deleted tags to be retained (if they themselves are allowed)
 	PreserveChildren() Cleaner
+	// AllowGlobalAttrs allows attributes on every whitelisted tag. Like the attributes of a
+	// Tagdef, these may be wildcard patterns such as "data-*" or "aria-*", which never
+	// match event handlers, style, srcdoc or URL attributes
+	AllowGlobalAttrs(attrs ...string) Cleaner
+	// DefaultProtocols sets the protocols allowed in URL attributes (e.g. href, src, cite)
+	// whose protocols are not enforced by their Tagdef. Relative URLs remain allowed in
+	// these attributes. Default: ftp, http, https, mailto
+	DefaultProtocols(protocols ...string) Cleaner
+	// AllowHosts restricts URLs in attributes with enforced protocols to hosts matching the
+	// patterns, except where a Tagdef allows its own hosts. Patterns are as for Hostset
+	AllowHosts(hosts ...string) Cleaner
+	// DenyHosts rejects URLs in attributes with enforced protocols whose hosts match the
+	// patterns. Denied hosts take precedence over allowed hosts
+	DenyHosts(hosts ...string) Cleaner
+	// WithBaseURL causes relative URLs in attributes with enforced protocols or host rules
+	// to be resolved against base, which should be absolute. Protocol and host rules are
+	// then applied to the resolved URL. A nil base leaves relative URLs unresolved
+	WithBaseURL(base *url.URL) Cleaner
+	// AllowSchemeRelative allows scheme-relative URLs (e.g. "//example.com/x") that are not
+	// resolved against a base URL. They are checked as https: URLs, so https must be an
+	// allowed protocol and the host must satisfy the host rules. By default they are
+	// rejected, as they can point anywhere
+	AllowSchemeRelative() Cleaner
+	// NormalizeURLs causes URLs in attributes with enforced protocols or host rules to be
+	// normalized: the scheme and host are lowercased, internationalized hosts converted to
+	// punycode, default ports removed and query parameters matching stripParams (which may
+	// be wildcard patterns) removed. If no parameters are given, TrackingParams are stripped.
+	// Host rules are applied to the normalized host
+	NormalizeURLs(stripParams ...string) Cleaner
+	// CheckHomographs detects URLs in attributes with enforced protocols whose hosts mix
+	// scripts or imitate Latin hosts (e.g. with Cyrillic letters), and applies action to them
+	CheckHomographs(action HomographAction) Cleaner
+	// RewriteURLs sets a rewriter applied to the values of URL attributes that pass
+	// validation, e.g. to route images through a proxy with CamoRewriter
+	RewriteURLs(rewriter URLRewriter) Cleaner
+	// WithLinkPolicy sets the rel and target attributes of links according to policy,
+	// rather than the whitelist
+	WithLinkPolicy(policy LinkPolicy) Cleaner
+	// Strict causes the Clean methods to reject rather than clean input that violates the
+	// cleaner's rules, returning a *ValidationError listing the violations
+	Strict() Cleaner
+	// DocumentMode causes whole documents to be sanitized rather than their body content.
+	// The doctype, <html lang dir>, <head> with <title> and safe <meta> tags, and <body>
+	// are retained, while anything not whitelisted (e.g. <script>, <base>, <link> or
+	// <meta http-equiv>) is still removed
+	DocumentMode() Cleaner
 
 	AddTransformer(TransformFunc) Cleaner
+	// AddTransformerE adds a transformer that may return an error, which aborts cleaning
+	AddTransformerE(TransformErrFunc) Cleaner
+	// AddTransformerFor adds a transformer that is only applied to elements matching a
+	// CSS selector. Supported are type selectors, *, .class, #id, [attr], [attr=value],
+	// :first-child, the descendant and > combinators, and comma-separated lists. The
+	// selector is matched as the element is reached, when its ancestors and preceding
+	// siblings have been sanitized but its own attributes have not. It panics if the
+	// selector cannot be parsed
+	AddTransformerFor(selector string, t TransformFunc) Cleaner
+	// TryAddTransformerFor is like AddTransformerFor, but returns an error instead of
+	// panicking if the selector cannot be parsed, leaving the cleaner unchanged
+	TryAddTransformerFor(selector string, t TransformFunc) (Cleaner, error)
+	// AddPostTransformer adds a transformer that is applied to each node that survived
+	// sanitization. Post-transformers run after all nodes have been checked against the
+	// whitelist, and any nodes or attributes they add or change are checked again
+	AddPostTransformer(TransformFunc) Cleaner
+	// AddPostTransformerE adds a post-transformer that may return an error, which aborts
+	// cleaning
+	AddPostTransformerE(TransformErrFunc) Cleaner
+	// AddFinalizer adds a function that is called with the document once sanitization and
+	// post-transformers are complete. Finalizers run in the order they were added, and
+	// their changes are checked against the whitelist like those of post-transformers
+	AddFinalizer(FinalizerFunc) Cleaner
+	// AddFinalizerE adds a finalizer that may return an error, which aborts cleaning
+	AddFinalizerE(FinalizerErrFunc) Cleaner
+
+	// Clone returns an independent copy of the cleaner. Changes to either cleaner
+	// do not affect the other
+	Clone() Cleaner
+	// Compile returns an immutable Policy built from a deep copy of the cleaner's rules
+	Compile() *Policy
 }
 
 type cleaner struct {
 	// the whitelist of allowed tags and their allowed attributes
 	w whitelist
 
+	// custom is the whitelist of allowed custom elements, which have no atom
+	custom customWhitelist
+
 	// preserveChildren controls whether children of deleted nodes are also deleted. This
 	// setting does not apply to elements that can contain no user-facing text (e.g. <script>)
 	// Default: false
 	preserveChildren bool
 
+	// globalAttrs are attributes allowed on every whitelisted tag
+	globalAttrs Attrset
+
+	// defaultProtocols are the protocols allowed in URL attributes without an enforced
+	// protocol rule. If nil, defaultURLProtocols are used
+	defaultProtocols Protoset
+
+	// allowedHosts and deniedHosts are host rules applied to all URL attributes whose
+	// protocols are enforced. A nil allowedHosts permits any host
+	allowedHosts Hostset
+	deniedHosts  Hostset
+
+	// baseURL is used to resolve relative URLs. Default: nil
+	baseURL *url.URL
+	// schemeRelative allows unresolved scheme-relative URLs. Default: false
+	schemeRelative bool
+
+	// normalizeURLs controls whether URLs are normalized, and stripParams lists the query
+	// parameters removed from them. Default: false
+	normalizeURLs bool
+	stripParams   []string
+
+	// detectHomographs controls whether confusable hosts are detected, and
+	// homographAction what is done with them. Default: false
+	detectHomographs bool
+	homographAction  HomographAction
+
+	// rewriter rewrites validated URLs. Default: nil
+	rewriter URLRewriter
+
+	// links controls the rel and target attributes of links. Default: nil
+	links *linkRules
+
+	// strict controls whether input that violates the whitelist is rejected with a
+	// ValidationError rather than cleaned. Default: false
+	strict bool
+
+	// documentMode controls whether document structure (html, head and body) is retained.
+	// Default: false
+	documentMode bool
+
 	// transforms is a list of transforms registered with this cleaner
-	transforms []TransformFunc
+	transforms []TransformErrFunc
+	// postTransforms are applied to the sanitized tree
+	postTransforms []TransformErrFunc
+	// finalizers are called with the document after postTransforms
+	finalizers []FinalizerErrFunc
+
+	// rules holds the lookups precomputed by Compile. Default: nil
+	rules *compiledRules
 }
 
 var errorInvalidProtocol = errors.New("invalid protocol")
 var errorRelativeLink = errors.New("relative links disallowed")
+var errorHostNotAllowed = errors.New("host not allowed")
+var errorInvalidSrcset = errors.New("no valid srcset candidates")
+var errorInvalidURL = errors.New("invalid URL")
+var errorSchemeRelative = errors.New("scheme-relative links disallowed")
+var errorInvalidDataURI = errors.New("data URI not allowed")
 
 func (c *cleaner) Clean(input io.Reader) (*html.Node, error) {
 	doc, err := html.Parse(input)
@@ -53,11 +215,41 @@ func (c *cleaner) Clean(input io.Reader) (*html.Node, error) {
 		return doc, err
 	}
 
-	c.cleanRecursive(doc)
+	err = c.clean(doc, nil)
+	if err != nil {
+		return nil, err
+	}
 
 	return doc, nil
 }
 
+func (c *cleaner) CleanWithReport(input io.Reader) (*html.Node, *Report, error) {
+	doc, err := html.Parse(input)
+	if err != nil {
+		return doc, nil, err
+	}
+
+	report := newReport(doc)
+	err = c.clean(doc, report)
+	if err != nil {
+		return nil, report, err
+	}
+
+	return doc, report, nil
+}
+
+func (c *cleaner) Validate(input io.Reader) error {
+	doc, err := html.Parse(input)
+	if err != nil {
+		return err
+	}
+
+	// the parsed document is private to this call, so cleaning it leaves the input untouched
+	report := newReport(doc)
+	c.cleanRecursive(doc, report, nil)
+	return report.violations()
+}
+
 func (c *cleaner) CleanNode(root *html.Node) (*html.Node, error) {
 	if root == nil {
 		return root, errors.New("root cannot be nil")
@@ -70,11 +262,42 @@ func (c *cleaner) CleanNode(root *html.Node) (*html.Node, error) {
 		doc = root
 	}
 
-	c.cleanRecursive(doc)
+	err := c.clean(doc, nil)
+	if err != nil {
+		return nil, err
+	}
 
 	return doc, nil
 }
 
+func (c *cleaner) CleanFragment(input io.Reader, context atom.Atom) ([]*html.Node, error) {
+	if context == 0 {
+		context = atom.Body
+	}
+	nodes, err := html.ParseFragment(input, &html.Node{Type: html.ElementNode, DataAtom: context, Data: context.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	// the parsed nodes have no parent, so clean them as the children of a temporary document
+	doc := &html.Node{Type: html.DocumentNode}
+	for _, n := range nodes {
+		doc.AppendChild(n)
+	}
+	err = c.clean(doc, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*html.Node
+	for doc.FirstChild != nil {
+		n := doc.FirstChild
+		doc.RemoveChild(n)
+		result = append(result, n)
+	}
+	return result, nil
+}
+
 func (c *cleaner) CleanString(input string) (string, error) {
 	doc, err := c.Clean(strings.NewReader(input))
 	if err != nil {
@@ -90,7 +313,16 @@ func (c *cleaner) CleanString(input string) (string, error) {
 
 func (c *cleaner) AddTags(tags ...*Tagdef) Cleaner {
 	for _, tagdef := range tags {
-		c.w[tagdef.Tag] = tagdef
+		if tagdef.Tag != 0 {
+			c.w[tagdef.Tag] = tagdef
+		} else if validCustomElementName(tagdef.Name) {
+			if c.custom == nil {
+				c.custom = make(customWhitelist)
+			}
+			c.custom[tagdef.Name] = tagdef
+		} else {
+			panic(fmt.Sprintf("gsoup: invalid custom element name %q", tagdef.Name))
+		}
 	}
 	return c
 }
@@ -102,80 +334,412 @@ func (c *cleaner) RemoveTags(tags ...atom.Atom) Cleaner {
 	return c
 }
 
+func (c *cleaner) RemoveTagNames(names ...string) Cleaner {
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if tag := atom.Lookup([]byte(name)); tag != 0 {
+			delete(c.w, tag)
+		} else {
+			delete(c.custom, name)
+		}
+	}
+	return c
+}
+
 func (c *cleaner) PreserveChildren() Cleaner {
 	c.preserveChildren = true
 	return c
 }
 
+func (c *cleaner) AllowGlobalAttrs(attrs ...string) Cleaner {
+	if c.globalAttrs == nil {
+		c.globalAttrs = make(Attrset)
+	}
+	for _, attr := range attrs {
+		c.globalAttrs[normalizeAttrKey(attr)] = struct{}{}
+	}
+	return c
+}
+
+func (c *cleaner) DefaultProtocols(protocols ...string) Cleaner {
+	c.defaultProtocols = make(Protoset)
+	for _, proto := range protocols {
+		proto = normalizeProtocol(proto)
+		if proto != "" {
+			c.defaultProtocols[proto] = struct{}{}
+		}
+	}
+	return c
+}
+
+func (c *cleaner) AllowHosts(hosts ...string) Cleaner {
+	c.allowedHosts = addHosts(c.allowedHosts, hosts)
+	return c
+}
+
+func (c *cleaner) DenyHosts(hosts ...string) Cleaner {
+	c.deniedHosts = addHosts(c.deniedHosts, hosts)
+	return c
+}
+
+func (c *cleaner) AllowSchemeRelative() Cleaner {
+	c.schemeRelative = true
+	return c
+}
+
+func (c *cleaner) WithBaseURL(base *url.URL) Cleaner {
+	c.baseURL = nil
+	if base != nil {
+		// copy the URL so later changes by the caller have no effect
+		u := *base
+		c.baseURL = &u
+	}
+	return c
+}
+
+func (c *cleaner) NormalizeURLs(stripParams ...string) Cleaner {
+	if len(stripParams) == 0 {
+		stripParams = TrackingParams
+	}
+	c.normalizeURLs = true
+	c.stripParams = nil
+	for _, param := range stripParams {
+		c.stripParams = append(c.stripParams, strings.ToLower(strings.TrimSpace(param)))
+	}
+	return c
+}
+
+func (c *cleaner) CheckHomographs(action HomographAction) Cleaner {
+	c.detectHomographs = true
+	c.homographAction = action
+	return c
+}
+
+func (c *cleaner) RewriteURLs(rewriter URLRewriter) Cleaner {
+	c.rewriter = rewriter
+	return c
+}
+
+func (c *cleaner) WithLinkPolicy(policy LinkPolicy) Cleaner {
+	c.links = newLinkRules(policy)
+	return c
+}
+
+func (c *cleaner) Strict() Cleaner {
+	c.strict = true
+	return c
+}
+
+func (c *cleaner) DocumentMode() Cleaner {
+	c.documentMode = true
+	return c
+}
+
 func (c *cleaner) AddTransformer(t TransformFunc) Cleaner {
+	c.transforms = append(c.transforms, t.errFunc())
+	return c
+}
+
+func (c *cleaner) AddTransformerE(t TransformErrFunc) Cleaner {
 	c.transforms = append(c.transforms, t)
 	return c
 }
 
-// cleanRecursive performs a depth-first traversal of the DOM, removing nodes and attributes in place as it goes
-func (c *cleaner) cleanRecursive(n *html.Node) *html.Node {
-
-	// apply any transform functions
-	if n.Type == html.ElementNode || n.Type == html.TextNode {
-		for _, transform := range c.transforms {
-			transformed := transform(newXNode(n))
-			if transformed == nil {
-				n.Parent.RemoveChild(n)
-			} else {
-				newNode := transformed.(*tnode).node
-				if newNode != n {
-					if newNode.Parent != nil {
-						newNode.Parent.RemoveChild(newNode)
-					}
-					n.Parent.InsertBefore(newNode, n)
-					n.Parent.RemoveChild(n)
-					n = newNode
-				}
+func (c *cleaner) AddTransformerFor(selector string, t TransformFunc) Cleaner {
+	if _, err := c.TryAddTransformerFor(selector, t); err != nil {
+		panic("gsoup: " + err.Error())
+	}
+	return c
+}
+
+func (c *cleaner) TryAddTransformerFor(selector string, t TransformFunc) (Cleaner, error) {
+	sel, err := compileSelector(selector)
+	if err != nil {
+		return c, err
+	}
+	c.transforms = append(c.transforms, func(x XNode) (XNode, error) {
+		if tn, ok := x.(*tnode); ok && sel.matches(tn.node) {
+			return t(x), nil
+		}
+		return x, nil
+	})
+	return c, nil
+}
+
+func (c *cleaner) AddPostTransformer(t TransformFunc) Cleaner {
+	c.postTransforms = append(c.postTransforms, t.errFunc())
+	return c
+}
+
+func (c *cleaner) AddPostTransformerE(t TransformErrFunc) Cleaner {
+	c.postTransforms = append(c.postTransforms, t)
+	return c
+}
+
+func (c *cleaner) AddFinalizer(f FinalizerFunc) Cleaner {
+	c.finalizers = append(c.finalizers, func(x XNode) error {
+		f(x)
+		return nil
+	})
+	return c
+}
+
+func (c *cleaner) AddFinalizerE(f FinalizerErrFunc) Cleaner {
+	c.finalizers = append(c.finalizers, f)
+	return c
+}
+
+func (c *cleaner) Clone() Cleaner {
+	return c.clone()
+}
+
+func (c *cleaner) Compile() *Policy {
+	compiled := c.clone()
+	compiled.rules = compileRules(compiled)
+	return &Policy{c: compiled}
+}
+
+// clone returns a deep copy of the cleaner
+func (c *cleaner) clone() *cleaner {
+	return &cleaner{
+		w:                cloneWhitelist(c.w),
+		custom:           cloneCustomWhitelist(c.custom),
+		preserveChildren: c.preserveChildren,
+		globalAttrs:      cloneAttrset(c.globalAttrs),
+		defaultProtocols: cloneProtoset(c.defaultProtocols),
+		allowedHosts:     cloneHostset(c.allowedHosts),
+		deniedHosts:      cloneHostset(c.deniedHosts),
+		baseURL:          c.baseURL,
+		schemeRelative:   c.schemeRelative,
+		normalizeURLs:    c.normalizeURLs,
+		stripParams:      append([]string(nil), c.stripParams...),
+		detectHomographs: c.detectHomographs,
+		homographAction:  c.homographAction,
+		rewriter:         c.rewriter,
+		links:            c.links,
+		strict:           c.strict,
+		documentMode:     c.documentMode,
+		transforms:       append([]TransformErrFunc(nil), c.transforms...),
+		postTransforms:   append([]TransformErrFunc(nil), c.postTransforms...),
+		finalizers:       append([]FinalizerErrFunc(nil), c.finalizers...),
+	}
+}
+
+// clean sanitizes doc in place, recording removals in r if it is non-nil. In strict mode,
+// any removal causes a *ValidationError to be returned. A *TransformError is returned if
+// a transformer aborts cleaning
+func (c *cleaner) clean(doc *html.Node, r *Report) error {
+	if !c.strict {
+		return c.sanitize(doc, r)
+	}
+
+	if r == nil {
+		r = newReport(doc)
+	}
+	if err := c.sanitize(doc, r); err != nil {
+		return err
+	}
+	return r.violations()
+}
+
+// sanitize cleans doc in phases: transformers are applied to each node just before it
+// is checked against the whitelist, then post-transformers are applied to each node that
+// survived and finalizers are called. Anything the last two phases added or changed is
+// checked against the whitelist again. Removals are recorded in r if it is non-nil,
+// except those caused by post-transformers and finalizers rather than by the input.
+// Cleaning stops at the first error returned by a transformer or finalizer, leaving doc
+// partially cleaned
+func (c *cleaner) sanitize(doc *html.Node, r *Report) error {
+	if len(c.transforms) == 0 && len(c.postTransforms) == 0 && len(c.finalizers) == 0 {
+		c.cleanRecursive(doc, r, nil)
+		return nil
+	}
+
+	p := newCleanPass()
+	if err := c.cleanPhase(doc, r, p, c.transforms, PhaseTransform); err != nil {
+		return err
+	}
+	if len(c.postTransforms) > 0 {
+		if err := c.cleanPhase(doc, nil, p, c.postTransforms, PhasePostTransform); err != nil {
+			return err
+		}
+	}
+	for i, finalize := range c.finalizers {
+		if err := finalize(newXNode(doc, p)); err != nil {
+			return &TransformError{Phase: PhaseFinalize, Index: i, Node: doc, Err: err}
+		}
+	}
+	if len(c.finalizers) > 0 && (p.dirty || p.untracked) {
+		p.begin(nil, PhaseFinalize)
+		c.cleanRecursive(doc, nil, p)
+	}
+	return nil
+}
+
+// cleanRecursive performs a depth-first traversal of the DOM, removing nodes and attributes in place as it goes.
+// Removals are recorded in r if it is non-nil. If p is non-nil, its transformers are
+// applied to each node before it is checked, and nodes that are unchanged since they were
+// last checked are not checked again
+func (c *cleaner) cleanRecursive(n *html.Node, r *Report, p *cleanPass) *html.Node {
+	if p.shouldTransform(n) {
+		parent, prev, edits := n.Parent, n.PrevSibling, p.edits
+		n = c.transform(n, p)
+		if p.err != nil {
+			return nil
+		}
+		if p.edits != edits {
+			// the tree was restructured, so continue from the last node known to be in place
+			if prev != nil && prev.Parent == parent {
+				return prev.NextSibling
 			}
+			return parent.FirstChild
 		}
 	}
 
-	switch n.Type {
-	case html.ElementNode:
-		tagdef, ok := c.w[n.DataAtom]
-		if !ok {
+	validated := p.snapshot()
+	if !validated.unchanged(n) {
+		switch n.Type {
+		case html.ElementNode:
+			tagdef, ok := c.lookup(n)
+			if !ok {
+				r.removeNode(n, ReasonNotAllowed, c.shouldPreserveChildren(n))
+				return c.removeElement(n)
+			}
+
+			if !c.stripInvalidAttributes(n, tagdef, r, validated) {
+				r.removeNode(n, ReasonHostNotAllowed, c.shouldPreserveChildren(n))
+				return c.removeElement(n)
+			}
+
+		case html.DoctypeNode:
+			if c.documentMode {
+				// only the standard doctype is retained, so a legacy one can't trigger quirks mode
+				n.Data = "html"
+				n.Attr = nil
+				break
+			}
+			r.removeNode(n, ReasonNotAllowed, false)
 			return c.removeElement(n)
-		}
 
-		stripInvalidAttributes(n, tagdef)
+		case html.TextNode:
 
-	case html.ErrorNode, html.CommentNode, html.DoctypeNode:
-		return c.removeElement(n)
+		case html.DocumentNode:
+			if n.Parent != nil {
+				r.removeNode(n, ReasonNotAllowed, false)
+				return c.removeElement(n)
+			}
+
+		default:
+			// error, comment and raw nodes, the last of which would be rendered unescaped
+			r.removeNode(n, ReasonNotAllowed, false)
+			return c.removeElement(n)
+		}
+		validated.record(n)
 	}
 
 	ch := n.FirstChild
-	for ch != nil {
-		ch = c.cleanRecursive(ch)
+	for ch != nil && !p.failed() {
+		ch = c.cleanRecursive(ch, r, p)
 	}
 
 	return n.NextSibling
 }
 
-// stripInvalidAttributes removes non-whitelisted attributes on the node in place
-func stripInvalidAttributes(n *html.Node, tagdef *Tagdef) {
+// lookup returns the tagdef that applies to the element n, if it is allowed
+func (c *cleaner) lookup(n *html.Node) (*Tagdef, bool) {
+	if n.DataAtom == 0 {
+		// AddTags only accepts valid custom element names, so nothing else can match
+		tagdef, ok := c.custom[n.Data]
+		return tagdef, ok
+	}
+
+	tagdef, ok := c.w[n.DataAtom]
+	if !ok && c.documentMode {
+		tagdef, ok = documentWhitelist[n.DataAtom]
+	}
+	if ok && c.documentMode && n.DataAtom == atom.Meta && hasAttr(n, "http-equiv") {
+		// http-equiv can trigger refreshes, set cookies or alter the content security policy
+		return nil, false
+	}
+	return tagdef, ok
+}
+
+// stripInvalidAttributes removes non-whitelisted attributes on the node in place.
+// Removals are recorded in r if it is non-nil. It returns false if the element itself
+// must be removed, in which case its attributes are left incomplete. Attributes recorded
+// in validated are kept as they are
+func (c *cleaner) stripInvalidAttributes(n *html.Node, tagdef *Tagdef, r *Report, validated snapshot) bool {
+	links := c.links != nil && isLink(n)
+	var linkAttrs []html.Attribute
+
 	attrMap := make(map[string]int)
 	newAttr := n.Attr[:0]
 	for _, attr := range n.Attr {
 		normalizedAttr := normalizeAttrKey(attr.Key)
-		_, attrAllowed := tagdef.AllowedAttrs[normalizedAttr]
-		if attrAllowed {
-			normalizedVal, err := enforceProtocol(tagdef, normalizedAttr, attr.Val)
-			if err == nil {
-				attr.Key = normalizedAttr
-				attr.Val = normalizedVal
-				newAttr = append(newAttr, attr)
-				attrMap[attr.Key] = len(newAttr) - 1
+		if links && isLinkAttr(normalizedAttr) {
+			linkAttrs = append(linkAttrs, attr)
+			continue
+		}
+		if validated.trusts(n, attr) {
+			newAttr = append(newAttr, attr)
+			attrMap[attr.Key] = len(newAttr) - 1
+			continue
+		}
+		if !c.allowsAttr(tagdef, normalizedAttr) {
+			r.removeAttr(n, attr, ReasonNotAllowed)
+			continue
+		}
+
+		normalizedVal, err := c.enforceProtocol(tagdef, normalizedAttr, attr.Val)
+		if err == errorHostNotAllowed && tagdef.dropOnHostViolation {
+			return false
+		}
+		if err != nil {
+			r.removeAttr(n, attr, protocolReason(err))
+			continue
+		}
+
+		if normalizedAttr == "style" && tagdef.AllowedStyles != nil {
+			var removed []cssDeclaration
+			normalizedVal, removed = sanitizeStyle(tagdef, normalizedVal)
+			r.removeStyles(n, removed)
+			if normalizedVal == "" {
+				continue
 			}
 		}
+
+		if !c.validateAttr(tagdef, normalizedAttr, normalizedVal) {
+			r.removeAttr(n, attr, ReasonInvalidValue)
+			continue
+		}
+
+		if c.detectHomographs && c.protocolRule(tagdef, normalizedAttr) != nil {
+			normalizedVal = c.checkHomographs(n, normalizedAttr, normalizedVal, r)
+			if normalizedVal == "" {
+				r.removeAttr(n, attr, ReasonConfusableHost)
+				continue
+			}
+		}
+
+		if c.rewriter != nil && c.protocolRule(tagdef, normalizedAttr) != nil {
+			normalizedVal = c.rewriteURL(n, normalizedAttr, normalizedVal)
+			if normalizedVal == "" {
+				r.removeAttr(n, attr, ReasonRewriterRejected)
+				continue
+			}
+		}
+
+		attr.Key = normalizedAttr
+		attr.Val = normalizedVal
+		newAttr = append(newAttr, attr)
+		attrMap[attr.Key] = len(newAttr) - 1
 	}
 
 	// add any enforced attributes
 	for key, value := range tagdef.EnforcedAttrs {
+		if links && isLinkAttr(key) {
+			continue
+		}
 		index, ok := attrMap[key]
 		if ok {
 			newAttr[index].Val = value
@@ -185,39 +749,216 @@ func stripInvalidAttributes(n *html.Node, tagdef *Tagdef) {
 		}
 	}
 
+	if links {
+		newAttr = c.links.apply(n, newAttr, linkAttrs, r)
+	}
+
 	n.Attr = newAttr
+	return true
 }
 
-func enforceProtocol(tagdef *Tagdef, attrKey string, attrVal string) (string, error) {
-	if tagdef.EnforcedProtocols == nil {
-		return attrVal, nil
+// allowsAttr reports whether the tagdef or the cleaner's global attributes allow the attr
+func (c *cleaner) allowsAttr(tagdef *Tagdef, attrKey string) bool {
+	if t := c.rules.tag(tagdef); t != nil {
+		return t.attrs.allows(attrKey) || c.rules.globalAttrs.allows(attrKey)
 	}
-	allowedProtos, enforce := tagdef.EnforcedProtocols[attrKey]
-	if !enforce {
+	return tagdef.AllowedAttrs.allows(attrKey) || c.globalAttrs.allows(attrKey)
+}
+
+// enforceProtocol checks a URL attribute value against the protocol rules that apply to
+// it and the host rules of both the tagdef and the cleaner, returning the normalized URL
+func (c *cleaner) enforceProtocol(tagdef *Tagdef, attrKey string, attrVal string) (string, error) {
+	rule := c.protocolRule(tagdef, attrKey)
+	if rule == nil && !c.hasURLRules(tagdef, attrKey) {
 		return attrVal, nil
 	}
 
-	// url must be parsable to be valid
-	u, err := url.Parse(attrVal)
+	if attrKey == "srcset" {
+		return c.enforceSrcset(tagdef, attrKey, attrVal, rule)
+	}
+
+	u, err := c.checkURL(tagdef, attrKey, attrVal, rule)
 	if err != nil {
 		return "", err
 	}
+	return u.String(), nil
+}
+
+// hasURLRules reports whether the tagdef has host or data URI rules for the attr
+func (c *cleaner) hasURLRules(tagdef *Tagdef, attrKey string) bool {
+	if t := c.rules.tag(tagdef); t != nil {
+		_, ok := t.urlAttrs[attrKey]
+		return ok
+	}
+	_, allowRule := tagdef.AllowedHosts[attrKey]
+	_, denyRule := tagdef.DeniedHosts[attrKey]
+	_, dataRule := tagdef.AllowedDataURIs[attrKey]
+	return allowRule || denyRule || dataRule
+}
+
+// protocolRule describes the protocols allowed in a URL attribute
+type protocolRule struct {
+	protocols     Protoset
+	allowRelative bool
+}
+
+// protocolRule returns the protocol rule for the given attr: the tagdef's own, or the
+// cleaner's default protocols if the attr is a known URL attribute. Otherwise nil
+func (c *cleaner) protocolRule(tagdef *Tagdef, attrKey string) *protocolRule {
+	if t := c.rules.tag(tagdef); t != nil {
+		return t.protocols[attrKey]
+	}
+	if protos, ok := tagdef.EnforcedProtocols[attrKey]; ok {
+		return &protocolRule{protocols: protos, allowRelative: tagdef.allowRelativeLinks}
+	}
+	if _, ok := urlAttrs[attrKey]; !ok {
+		return nil
+	}
+	if c.defaultProtocols != nil {
+		return &protocolRule{protocols: c.defaultProtocols, allowRelative: true}
+	}
+	return &protocolRule{protocols: defaultURLProtocols, allowRelative: true}
+}
+
+// checkURL canonicalizes and parses a single URL, resolves it against the base URL if
+// it is relative, and applies the protocol rule (if any) and host rules to it
+func (c *cleaner) checkURL(tagdef *Tagdef, attrKey string, rawURL string, rule *protocolRule) (*url.URL, error) {
+	rawURL, err := canonicalizeURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy, ok := c.dataURIPolicy(tagdef, attrKey, rule); ok && urlScheme(rawURL) == "data" {
+		if !policy.allows(rawURL) {
+			return nil, errorInvalidDataURI
+		}
+		return url.Parse(rawURL)
+	}
+
+	if rule != nil {
+		// the scheme must also be allowed after decoding entities, in case the value is
+		// decoded again before it reaches a browser
+		scheme, err := decodedScheme(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := rule.protocols[scheme]; scheme != "" && !ok {
+			return nil, errorInvalidProtocol
+		}
+	}
+
+	// scheme-relative URLs can point anywhere, so unless resolved they are only allowed by
+	// AllowSchemeRelative, and are then checked as https: URLs
+	schemeRelative := isSchemeRelative(rawURL) && c.baseURL == nil
+	if schemeRelative && !c.schemeRelative {
+		return nil, errorSchemeRelative
+	}
+
+	// url must be parsable to be valid, and special schemes must have a host
+	u, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if schemeRelative {
+		u.Scheme = "https"
+	}
+	if _, ok := specialSchemes[strings.ToLower(u.Scheme)]; ok && u.Host == "" {
+		return nil, errorInvalidURL
+	}
+
+	if c.baseURL != nil && !u.IsAbs() {
+		u = c.baseURL.ResolveReference(u)
+	}
+	if c.normalizeURLs {
+		normalizeURL(u, c.stripParams)
+	}
+
+	if rule != nil {
+		// relative link logic
+		if !u.IsAbs() && !rule.allowRelative {
+			return nil, errorRelativeLink
+		}
+		if u.IsAbs() {
+			if _, ok := rule.protocols[u.Scheme]; !ok {
+				return nil, errorInvalidProtocol
+			}
+		}
+	}
 
-	// relative link logic
-	if !u.IsAbs() && !tagdef.allowRelativeLinks {
-		return "", errorRelativeLink
+	if !c.allowHost(tagdef, attrKey, u, rule != nil) {
+		return nil, errorHostNotAllowed
 	}
-	if !u.IsAbs() {
-		return u.String(), nil
+	if schemeRelative {
+		u.Scheme = ""
 	}
+	return u, nil
+}
 
-	for allowedProto := range allowedProtos {
-		if u.Scheme == allowedProto {
-			return u.String(), nil
+// dataURIPolicy returns the policy for data: URIs in the given attr: the tagdef's own, or
+// the default policy if the attr's protocol rule allows data URIs
+func (c *cleaner) dataURIPolicy(tagdef *Tagdef, attrKey string, rule *protocolRule) (DataURIPolicy, bool) {
+	if policy, ok := tagdef.AllowedDataURIs[attrKey]; ok {
+		return policy, true
+	}
+	if rule != nil {
+		if _, ok := rule.protocols["data"]; ok {
+			return defaultDataURIPolicy, true
 		}
 	}
+	return DataURIPolicy{}, false
+}
+
+// allowHost applies host rules to the URL in the given attr. The cleaner's rules only
+// apply if the attr's protocols are enforced. Denied hosts are checked first, then the
+// tagdef's allowed hosts or, if it has none for the attr, the cleaner's
+func (c *cleaner) allowHost(tagdef *Tagdef, attrKey string, u *url.URL, enforce bool) bool {
+	if u.Host == "" {
+		return true
+	}
+	host := normalizeHost(u.Hostname())
+
+	if tagdef.DeniedHosts[attrKey].matches(host) || enforce && c.deniedHosts.matches(host) {
+		return false
+	}
 
-	return "", errorInvalidProtocol
+	allowed, ok := tagdef.AllowedHosts[attrKey]
+	if !ok && enforce {
+		allowed = c.allowedHosts
+	}
+	return allowed == nil || allowed.matches(host)
+}
+
+// validateAttr reports whether the attr value passes all validators registered for it,
+// either by name or by a matching wildcard pattern
+func (c *cleaner) validateAttr(tagdef *Tagdef, attrKey string, attrVal string) bool {
+	if t := c.rules.tag(tagdef); t != nil {
+		if !runValidators(tagdef.ValidatedAttrs[attrKey], attrVal) {
+			return false
+		}
+		for _, pattern := range t.validatorPatterns {
+			if pattern != attrKey && matchAttrPattern(pattern, attrKey) && !runValidators(tagdef.ValidatedAttrs[pattern], attrVal) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for key, validators := range tagdef.ValidatedAttrs {
+		if (key == attrKey || matchAttrPattern(key, attrKey)) && !runValidators(validators, attrVal) {
+			return false
+		}
+	}
+	return true
+}
+
+// runValidators reports whether the attr value passes all of the validators
+func runValidators(validators []AttrValidator, attrVal string) bool {
+	for _, validator := range validators {
+		if !validator.Validate(attrVal) {
+			return false
+		}
+	}
+	return true
 }
 
 func (c *cleaner) removeElement(n *html.Node) (result *html.Node) {
@@ -3,6 +3,7 @@ package gsoup
 import (
 	"bytes"
 	"errors"
+	"net/url"
 	"strconv"
 	"strings"
 	"testing"
@@ -18,22 +19,24 @@ func Test_FailGracefullyOnParseError(t *testing.T) {
 }
 
 func Test_stripInvalidAttributes(t *testing.T) {
+	c := NewEmptyCleaner().(*cleaner)
+
 	// basic passthrough
 	elem := ele("class")
 	def := T(atom.P, "class")
-	stripInvalidAttributes(elem, def)
+	c.stripInvalidAttributes(elem, def, nil, nil)
 	assert.Equal(t, 1, len(elem.Attr), "tag should have one attribute")
 	assert.Equal(t, "class", elem.Attr[0].Key, "elem should still contain key 'class'")
 
 	// basic strip
 	def = T(atom.P)
-	stripInvalidAttributes(elem, def)
+	c.stripInvalidAttributes(elem, def, nil, nil)
 	assert.Equal(t, 0, len(elem.Attr), "tag should have zero attributes")
 
 	// attributes should be found case insensitive and lowercased
 	def = T(atom.P, "class")
 	elem = ele("ClAsS", "OnClicK")
-	stripInvalidAttributes(elem, def)
+	c.stripInvalidAttributes(elem, def, nil, nil)
 	assert.Equal(t, 1, len(elem.Attr), "tag should have one attribute")
 	assert.Equal(t, "class", elem.Attr[0].Key, "elem should contain lowercased key 'class'")
 }
@@ -227,6 +230,96 @@ func Test_RemoveTags(t *testing.T) {
 	assert.False(t, ok, "div tag should still not appear in whitelist")
 }
 
+func Test_AddTags_CustomElements(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(TName("x-mention", "data-user")).(*cleaner)
+
+	assert.Equal(t, 1, len(c.custom))
+	_, ok := c.custom["x-mention"]
+	assert.True(t, ok, "x-mention should appear in the custom whitelist")
+	assert.Equal(t, 0, len(c.w), "custom elements should not be added to the atom whitelist")
+
+	c.RemoveTagNames("X-MENTION")
+	assert.Equal(t, 0, len(c.custom), "x-mention should no longer appear in the custom whitelist")
+
+	for _, tagdef := range []*Tagdef{TName("not_custom"), TName("font-face"), &Tagdef{Name: "X-mention"}, &Tagdef{}} {
+		assert.Panics(t, func() { NewEmptyCleaner().AddTags(tagdef) }, tagdef.Name)
+	}
+	assert.PanicsWithValue(t, `gsoup: invalid custom element name "not_custom"`, func() {
+		NewEmptyCleaner().AddTags(T(atom.B), TName("not_custom"))
+	})
+}
+
+func Test_RemoveTagNames(t *testing.T) {
+	c := NewBasicCleaner().(*cleaner)
+	c.RemoveTagNames("p", "not-there")
+
+	_, ok := c.w[atom.P]
+	assert.False(t, ok, "p tag should no longer appear in whitelist")
+}
+
+func Test_Clean_CustomElements(t *testing.T) {
+	c := NewBasicCleaner().AddTags(TName("x-mention", "data-user"), TName("my-embed"))
+
+	for input, expected := range customElementTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+
+	// the streaming cleaner consults the same whitelist
+	var buf bytes.Buffer
+	err := c.CleanTo(&buf, strings.NewReader(`<x-mention data-user="1" onclick="x">@bob</x-mention><x-other>y</x-other>`))
+	assert.Nil(t, err)
+	assert.Equal(t, `<x-mention data-user="1">@bob</x-mention>`, buf.String())
+
+	clone := c.Clone().RemoveTagNames("my-embed")
+	actual, _ := c.CleanString(`<my-embed>e</my-embed>`)
+	assert.Equal(t, `<my-embed>e</my-embed>`, actual, "cloned custom whitelists should be independent")
+	actual, _ = clone.CleanString(`<my-embed>e</my-embed>`)
+	assert.Equal(t, ``, actual)
+}
+
+func Test_AllowGlobalAttrs(t *testing.T) {
+	c := NewEmptyCleaner().(*cleaner)
+	c2 := c.AllowGlobalAttrs("TITLE", "aria-*")
+	assert.Equal(t, c, c2)
+	assert.Equal(t, Attrset{"title": struct{}{}, "aria-*": struct{}{}}, c.globalAttrs)
+
+	clone := c.Clone().AllowGlobalAttrs("lang").(*cleaner)
+	assert.Equal(t, 2, len(c.globalAttrs), "cloned global attrs should be independent")
+	assert.Equal(t, 3, len(clone.globalAttrs))
+}
+
+func Test_Clean_WildcardAndGlobalAttrs(t *testing.T) {
+	c := NewBasicCleaner().
+		AddTags(T(atom.Div, "data-*").ValidateAttr("data-*", MaxLength(5))).
+		AllowGlobalAttrs("title", "lang", "dir", "aria-*")
+
+	for input, expected := range wildcardAttrTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func Test_Clean_PatternsSkipSensitiveAttrs(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.P, "s*"))
+	actual, err := c.CleanString(`<p style="background:url(javascript:x)" srcdoc="x" span="1">x</p>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<p span="1">x</p>`, actual)
+
+	c = NewEmptyCleaner().AddTags(T(atom.Iframe)).AllowGlobalAttrs("*")
+	actual, err = c.CleanString(`<iframe srcdoc="<script>alert(1)</script>" style="x:expression(1)" src="javascript:alert(1)" title="t"></iframe>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<iframe title="t"></iframe>`, actual)
+
+	// named on the Tagdef, the attributes are subject to its style and protocol rules
+	c = NewEmptyCleaner().AddTags(T(atom.Iframe, "src").AllowStyles("color")).AllowGlobalAttrs("*")
+	actual, err = c.CleanString(`<iframe style="color: red; x:expression(1)" src="javascript:alert(1)" title="t"></iframe>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<iframe style="color: red" title="t"></iframe>`, actual)
+}
+
 func Test_PreserveChildren(t *testing.T) {
 	c := &cleaner{}
 	assert.False(t, c.preserveChildren, "default should be false")
@@ -293,6 +386,66 @@ func Test_Clean_EnforcedAttrValuesProperlyEscaped(t *testing.T) {
 	assert.Equal(t, expected, actual, "expected %s but got %s", expected, actual)
 }
 
+func Test_Clean_ValidatedAttrs(t *testing.T) {
+	c := NewRelaxedCleaner()
+
+	for input, expected := range validatedAttrTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func Test_CleanFragment(t *testing.T) {
+	c := NewRelaxedCleaner()
+
+	for context, tests := range fragmentTests {
+		for input, expected := range tests {
+			nodes, err := c.CleanFragment(strings.NewReader(input), context)
+			assert.Nil(t, err, "unexpected error: %v", err)
+			var buf bytes.Buffer
+			for _, n := range nodes {
+				assert.Nil(t, n.Parent, "returned nodes should be detached")
+				html.Render(&buf, n)
+			}
+			assert.Equal(t, expected, buf.String())
+		}
+	}
+}
+
+func Test_CleanFragment_Errors(t *testing.T) {
+	_, err := NewRelaxedCleaner().CleanFragment(badReader{}, atom.Div)
+	assert.NotNil(t, err)
+
+	nodes, err := NewRelaxedCleaner().Strict().CleanFragment(strings.NewReader(`<li onclick="x">a</li>`), atom.Ul)
+	assert.Nil(t, nodes)
+	assert.IsType(t, &ValidationError{}, err)
+}
+
+func Test_DocumentMode(t *testing.T) {
+	c := &cleaner{}
+	assert.False(t, c.documentMode, "default should be false")
+	c2 := c.DocumentMode()
+	assert.True(t, c.documentMode)
+	assert.True(t, c2.(*cleaner).documentMode)
+}
+
+func Test_Clean_DocumentMode(t *testing.T) {
+	c := NewBasicCleaner().DocumentMode()
+
+	for input, expected := range documentModeTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+
+	// user tagdefs take precedence over the document whitelist
+	c.AddTags(T(atom.Body, "class"))
+	actual, err := c.CleanString(`<body class="x" onload="y"><p>hi</p></body>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<html><head></head><body class="x"><p>hi</p></body></html>`, actual)
+}
+
 func ele(attrs ...string) *html.Node {
 	attributes := []html.Attribute{}
 	for _, key := range attrs {
@@ -304,54 +457,96 @@ func ele(attrs ...string) *html.Node {
 }
 
 func Test_enforceProtocol_notEnforced(t *testing.T) {
+	c := NewEmptyCleaner().(*cleaner)
 	tdef := &Tagdef{}
 
-	result, err := enforceProtocol(tdef, "href", "javascript:alert('hi!')")
+	result, err := c.enforceProtocol(tdef, "data-href", "javascript:alert('hi!')")
 	assert.Nil(t, err)
 	assert.Equal(t, "javascript:alert('hi!')", result)
 
 	tdef.EnforcedProtocols = make(Protomap)
 
-	result, err = enforceProtocol(tdef, "href", "javascript:alert('hi!')")
+	result, err = c.enforceProtocol(tdef, "data-href", "javascript:alert('hi!')")
 	assert.Nil(t, err)
 	assert.Equal(t, "javascript:alert('hi!')", result)
 }
 
+func Test_enforceProtocol_defaults(t *testing.T) {
+	c := NewEmptyCleaner().(*cleaner)
+	tdef := &Tagdef{}
+
+	// known URL attributes get the default protocols, and may be relative
+	for _, attr := range []string{"href", "src", "cite", "action", "formaction", "poster", "background", "longdesc", "usemap", "xlink:href"} {
+		_, err := c.enforceProtocol(tdef, attr, "javascript:alert('hi!')")
+		assert.Equal(t, errorInvalidProtocol, err, attr)
+		result, err := c.enforceProtocol(tdef, attr, "HTTPS://example.com/x")
+		assert.Nil(t, err, attr)
+		assert.Equal(t, "https://example.com/x", result)
+		result, err = c.enforceProtocol(tdef, attr, "x/y")
+		assert.Nil(t, err, attr)
+		assert.Equal(t, "x/y", result)
+	}
+
+	_, err := c.enforceProtocol(tdef, "href", "mailto:someone@example.com")
+	assert.Nil(t, err)
+	_, err = c.enforceProtocol(tdef, "href", "data:text/html,x")
+	assert.Equal(t, errorInvalidProtocol, err)
+
+	// the defaults can be overridden by the cleaner, or per attribute by the tagdef
+	c.DefaultProtocols("https")
+	_, err = c.enforceProtocol(tdef, "href", "mailto:someone@example.com")
+	assert.Equal(t, errorInvalidProtocol, err)
+	tdef.EnforceProtocols("href", "mailto")
+	_, err = c.enforceProtocol(tdef, "href", "mailto:someone@example.com")
+	assert.Nil(t, err)
+	_, err = c.enforceProtocol(tdef, "href", "/relative")
+	assert.Equal(t, errorRelativeLink, err)
+
+	result, err := c.enforceProtocol(tdef, "srcset", "a.png 1x, HTTPS://example.com/b.png 2x")
+	assert.Nil(t, err)
+	assert.Equal(t, "a.png 1x, https://example.com/b.png 2x", result)
+	_, err = c.enforceProtocol(tdef, "srcset", "javascript:alert(1) 2x")
+	assert.Equal(t, errorInvalidProtocol, err)
+}
+
 func Test_enforceProtocol_invalidURL(t *testing.T) {
+	c := NewEmptyCleaner().(*cleaner)
 	tdef := T(atom.A, "href").EnforceProtocols("href", "http", "https")
 
-	_, err := enforceProtocol(tdef, "href", ":alert('hi!')")
+	_, err := c.enforceProtocol(tdef, "href", ":alert('hi!')")
 	assert.NotNil(t, err)
 }
 
 func Test_enforceProtocol_relativeLink(t *testing.T) {
+	c := NewEmptyCleaner().(*cleaner)
 	tdef := T(atom.A, "href").EnforceProtocols("href", "http", "https")
 
-	_, err := enforceProtocol(tdef, "href", "/foo/bar")
+	_, err := c.enforceProtocol(tdef, "href", "/foo/bar")
 	assert.NotNil(t, err)
 
 	tdef.AllowRelativeLinks()
-	result, err := enforceProtocol(tdef, "href", "/foo/bar")
+	result, err := c.enforceProtocol(tdef, "href", "/foo/bar")
 	assert.Nil(t, err)
 	assert.Equal(t, "/foo/bar", result)
 }
 
 func Test_enforceProtocol_allowed(t *testing.T) {
+	c := NewEmptyCleaner().(*cleaner)
 	tdef := T(atom.A, "href").EnforceProtocols("href", "https")
 
-	_, err := enforceProtocol(tdef, "href", "HTTP://google.com?q=alan+turing")
+	_, err := c.enforceProtocol(tdef, "href", "HTTP://google.com?q=alan+turing")
 	assert.NotNil(t, err)
 
-	result, err := enforceProtocol(tdef, "href", "HTTPS://google.com?q=alan+turing")
+	result, err := c.enforceProtocol(tdef, "href", "HTTPS://google.com?q=alan+turing")
 	assert.Nil(t, err)
 	assert.Equal(t, "https://google.com?q=alan+turing", result)
 
 	tdef.EnforceProtocols("href", "https", "mailto")
-	result, err = enforceProtocol(tdef, "href", "MaIlTo:nathan@neocortical.net")
+	result, err = c.enforceProtocol(tdef, "href", "MaIlTo:nathan@neocortical.net")
 	assert.Nil(t, err)
 	assert.Equal(t, "mailto:nathan@neocortical.net", result)
 
-	result, err = enforceProtocol(tdef, "href", "javascript:MaIlTo:NATHAN@neocortical.net")
+	result, err = c.enforceProtocol(tdef, "href", "javascript:MaIlTo:NATHAN@neocortical.net")
 	assert.NotNil(t, err)
 }
 
@@ -368,6 +563,134 @@ func Test_Cleaner_protocolEnforcement(t *testing.T) {
 	}
 }
 
+func Test_Clean_DefaultProtocols(t *testing.T) {
+	c := NewBasicCleaner().AddTags(T(atom.Div, "background", "longdesc", "title"))
+
+	for input, expected := range defaultProtocolTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func Test_enforceProtocol_hosts(t *testing.T) {
+	c := NewEmptyCleaner().DenyHosts("*.tracker.example").(*cleaner)
+	tdef := T(atom.A, "href").EnforceProtocols("href", "http", "https").AllowRelativeLinks()
+
+	_, err := c.enforceProtocol(tdef, "href", "https://pixel.tracker.example/x")
+	assert.Equal(t, errorHostNotAllowed, err)
+
+	result, err := c.enforceProtocol(tdef, "href", "https://tracker.example/x")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://tracker.example/x", result)
+
+	c.AllowHosts("example.com")
+	_, err = c.enforceProtocol(tdef, "href", "https://tracker.example/x")
+	assert.Equal(t, errorHostNotAllowed, err)
+	_, err = c.enforceProtocol(tdef, "href", "//evil.example/x")
+	assert.Equal(t, errorSchemeRelative, err)
+	c.AllowSchemeRelative()
+	_, err = c.enforceProtocol(tdef, "href", "//evil.example/x")
+	assert.Equal(t, errorHostNotAllowed, err)
+	result, err = c.enforceProtocol(tdef, "href", "//EXAMPLE.com/x")
+	assert.Nil(t, err)
+	assert.Equal(t, "//EXAMPLE.com/x", result)
+	_, err = c.enforceProtocol(T(atom.A, "href").EnforceProtocols("href", "http"), "href", "//example.com/x")
+	assert.Equal(t, errorInvalidProtocol, err, "scheme-relative URLs are checked as https")
+	_, err = c.enforceProtocol(tdef, "href", "///evil.example/x")
+	assert.Equal(t, errorHostNotAllowed, err)
+	c.schemeRelative = false
+	_, err = c.enforceProtocol(tdef, "href", "https://example.com@evil.example/x")
+	assert.Equal(t, errorHostNotAllowed, err)
+
+	// browsers find the host of special schemes whatever the number of slashes
+	for _, rawURL := range []string{"http:evil.example/x", "https:/evil.example/x", "https:evil.example", "HTTPS:///evil.example", "wss:evil.example"} {
+		_, err = c.enforceProtocol(T(atom.A, "href").EnforceProtocols("href", "http", "https", "wss"), "href", rawURL)
+		assert.Equal(t, errorHostNotAllowed, err, rawURL)
+	}
+	result, err = c.enforceProtocol(tdef, "href", "https:example.com/x")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/x", result)
+	_, err = c.enforceProtocol(tdef, "href", "https:/?x")
+	assert.Equal(t, errorInvalidURL, err)
+	_, err = c.enforceProtocol(tdef, "href", "HTTPS://EXAMPLE.COM.:443/x")
+	assert.Nil(t, err)
+	_, err = c.enforceProtocol(tdef, "href", "/relative")
+	assert.Nil(t, err)
+
+	// tagdef rules take the place of the cleaner's allowed hosts, but not its denied hosts
+	tdef.AllowHosts("href", ".tracker.example")
+	_, err = c.enforceProtocol(tdef, "href", "https://example.com/x")
+	assert.Equal(t, errorHostNotAllowed, err)
+	_, err = c.enforceProtocol(tdef, "href", "https://tracker.example/x")
+	assert.Nil(t, err)
+	_, err = c.enforceProtocol(tdef, "href", "https://pixel.tracker.example/x")
+	assert.Equal(t, errorHostNotAllowed, err)
+
+	// tagdef host rules apply even where protocols are not enforced
+	tdef = T(atom.Div, "data-cite").DenyHosts("data-cite", "evil.example")
+	_, err = c.enforceProtocol(tdef, "data-cite", "javascript:x")
+	assert.Nil(t, err)
+	_, err = c.enforceProtocol(tdef, "data-cite", "http://evil.example/")
+	assert.Equal(t, errorHostNotAllowed, err)
+}
+
+func Test_Clean_HostRules(t *testing.T) {
+	c := NewBasicCleanerWithImages().
+		AddTags(T(atom.Img, "src", "alt").EnforceProtocols("src", "http", "https").DropElementOnHostViolation()).
+		DenyHosts("phishing.example", "*.tracker.example")
+
+	for input, expected := range hostRuleTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+
+	_, report, err := c.CleanWithReport(strings.NewReader(`<p><img src="https://a.tracker.example/p.gif"></p>`))
+	assert.Nil(t, err)
+	assert.Equal(t, []Removal{{Kind: RemovedElement, Reason: ReasonHostNotAllowed, Name: "img", Path: "html/body/p"}}, report.Removals)
+
+	var buf bytes.Buffer
+	err = c.CleanTo(&buf, strings.NewReader(`<p>x<img src="https://a.tracker.example/p.gif">y</p>`))
+	assert.Nil(t, err)
+	assert.Equal(t, `<p>xy</p>`, buf.String())
+}
+
+func Test_CleanNode_RemovesOtherNodeTypes(t *testing.T) {
+	p := &html.Node{Type: html.ElementNode, DataAtom: atom.P, Data: "p"}
+	p.AppendChild(&html.Node{Type: html.TextNode, Data: "a"})
+	p.AppendChild(&html.Node{Type: html.RawNode, Data: "<script>alert(1)</script>"})
+	nested := &html.Node{Type: html.DocumentNode}
+	nested.AppendChild(&html.Node{Type: html.RawNode, Data: "<img src=x onerror=alert(2)>"})
+	p.AppendChild(nested)
+	p.AppendChild(&html.Node{Type: html.CommentNode, Data: "c"})
+
+	doc, err := NewEmptyCleaner().AddTags(T(atom.P)).CleanNode(p)
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	html.Render(&buf, doc)
+	assert.Equal(t, `<p>a</p>`, buf.String())
+}
+
+func Test_WithBaseURL(t *testing.T) {
+	base, _ := url.Parse("https://blog.example/posts/1/")
+	c := NewBasicCleanerWithImages().WithBaseURL(base).DenyHosts("evil.example")
+
+	// the cleaner keeps its own copy of the base URL
+	base.Host = "evil.example"
+
+	for input, expected := range baseURLTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+
+	c.WithBaseURL(nil)
+	actual, err := c.CleanString(`<a href="/about">x</a>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<a rel="nofollow">x</a>`, actual)
+}
+
 func eleWithData(datum int) *html.Node {
 	return &html.Node{
 		Data: strconv.Itoa(datum),
@@ -422,6 +745,88 @@ var protocolEnforcementTests = map[string]string{
 	`<a href="javascript:alert('hi!')">link</a>`:       `<a rel="nofollow">link</a>`,
 }
 
+var validatedAttrTests = map[string]string{
+	`<ol start="3" type="a"><li>x</li></ol>`:                     `<ol start="3" type="a"><li>x</li></ol>`,
+	`<ol start="javascript:alert(1)" type="z"><li>x</li></ol>`:   `<ol><li>x</li></ol>`,
+	`<ul type="square"><li>x</li></ul>`:                          `<ul type="square"><li>x</li></ul>`,
+	`<ul type="expression(alert(1))"><li>x</li></ul>`:            `<ul><li>x</li></ul>`,
+	`<img src="http://a.com/b.png" width="100" height="50%"/>`:   `<img src="http://a.com/b.png" width="100" height="50%"/>`,
+	`<img src="http://a.com/b.png" width="100px" align="evil"/>`: `<img src="http://a.com/b.png"/>`,
+}
+
+var fragmentTests = map[atom.Atom]map[string]string{
+	0: {
+		`<p>a</p><div onclick="x">b</div>`: `<p>a</p><div>b</div>`,
+		`<td>cell</td>`:                    `cell`,
+	},
+	atom.Div: {
+		`<p>a</p><script>alert(1)</script>`: `<p>a</p>`,
+	},
+	atom.Ul: {
+		`<li>a</li><li onclick="x">b</li>`: `<li>a</li><li>b</li>`,
+	},
+	atom.Tbody: {
+		`<tr><td colspan="2">a</td></tr>`: `<tr><td colspan="2">a</td></tr>`,
+	},
+	atom.Tr: {
+		`<td>a</td><th scope="bogus">b</th>`: `<td>a</td><th>b</th>`,
+	},
+}
+
+var documentModeTests = map[string]string{
+	`<p>hi</p>`: `<html><head></head><body><p>hi</p></body></html>`,
+	`<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01//EN" "http://www.w3.org/TR/html4/strict.dtd"><html lang="en-US" dir="rtl" onclick="x"><head><title>Hi</title></head><body><p>hi</p></body></html>`:            `<!DOCTYPE html><html lang="en-US" dir="rtl"><head><title>Hi</title></head><body><p>hi</p></body></html>`,
+	`<html lang="javascript:alert(1)"><head><meta charset="utf-8"><meta name="description" content="about"><meta name="referrer" content="unsafe-url"></head></html>`:                                           `<html><head><meta charset="utf-8"/><meta name="description" content="about"/><meta content="unsafe-url"/></head><body></body></html>`,
+	`<head><meta http-equiv="refresh" content="0;url=javascript:alert(1)"><base href="http://evil.com/"><link rel="stylesheet" href="http://evil.com/x.css"><script>alert(1)</script><style>p{}</style></head>`: `<html><head></head><body></body></html>`,
+	`<body onload="alert(1)"><!-- comment --><div>gone</div></body>`: `<html><head></head><body></body></html>`,
+}
+
+var customElementTests = map[string]string{
+	`<x-mention data-user="42" onclick="alert(1)">@alice</x-mention>`: `<x-mention data-user="42">@alice</x-mention>`,
+	`<p><my-embed>e</my-embed></p>`:                                   `<p><my-embed>e</my-embed></p>`,
+	`<x-other>gone</x-other>`:                                         ``,
+	`<unknown>gone</unknown>`:                                         ``,
+}
+
+var wildcardAttrTests = map[string]string{
+	`<div data-user="bob" data-x="1" onclick="x">d</div>`:    `<div data-user="bob" data-x="1">d</div>`,
+	`<div data-user="toolong">d</div>`:                       `<div>d</div>`,
+	`<p title="t" lang="en" aria-hidden="true" id="x">p</p>`: `<p title="t" lang="en" aria-hidden="true">p</p>`,
+	`<b data-user="bob" dir="rtl">b</b>`:                     `<b dir="rtl">b</b>`,
+	`<span aria-onclick="x" onaria-x="y">s</span>`:           `<span aria-onclick="x">s</span>`,
+}
+
+var defaultProtocolTests = map[string]string{
+	`<q cite="javascript:alert(1)">q</q>`:           `<q>q</q>`,
+	`<q cite="https://example.com/">q</q>`:          `<q cite="https://example.com/">q</q>`,
+	`<q cite="/ref">q</q>`:                          `<q cite="/ref">q</q>`,
+	`<div background="javascript:alert(1)">d</div>`: `<div>d</div>`,
+	`<div longdesc=" vbscript:x" title="t">d</div>`: `<div title="t">d</div>`,
+}
+
+var hostRuleTests = map[string]string{
+	`<a href="https://phishing.example/login">x</a>`:                   `<a rel="nofollow">x</a>`,
+	`<a href="https://PHISHING.example./login">x</a>`:                  `<a rel="nofollow">x</a>`,
+	`<a href="https:phishing.example/login">x</a>`:                     `<a rel="nofollow">x</a>`,
+	`<a href="http:/phishing.example/login">x</a>`:                     `<a rel="nofollow">x</a>`,
+	`<p>a<img src="https:pixel.tracker.example/p.gif" alt="x">b</p>`:   `<p>ab</p>`,
+	`<a href="https:cdn.example/x">x</a>`:                              `<a href="https://cdn.example/x" rel="nofollow">x</a>`,
+	`<a href="https://sub.phishing.example/login">x</a>`:               `<a href="https://sub.phishing.example/login" rel="nofollow">x</a>`,
+	`<a href="mailto:someone@phishing.example">x</a>`:                  `<a href="mailto:someone@phishing.example" rel="nofollow">x</a>`,
+	`<p>a<img src="https://pixel.tracker.example/p.gif" alt="x">b</p>`: `<p>ab</p>`,
+	`<p><img src="https://cdn.example/p.gif" alt="x"></p>`:             `<p><img src="https://cdn.example/p.gif" alt="x"/></p>`,
+}
+
+var baseURLTests = map[string]string{
+	`<a href="/about">x</a>`:                     `<a href="https://blog.example/about" rel="nofollow">x</a>`,
+	`<a href="../2/?page=2#top">x</a>`:           `<a href="https://blog.example/posts/2/?page=2#top" rel="nofollow">x</a>`,
+	`<a href="//evil.example/x">x</a>`:           `<a rel="nofollow">x</a>`,
+	`<img src="img/a.png">`:                      `<img src="https://blog.example/posts/1/img/a.png"/>`,
+	`<blockquote cite="ref.html">q</blockquote>`: `<blockquote cite="https://blog.example/posts/1/ref.html">q</blockquote>`,
+	`<a href="javascript:alert(1)">x</a>`:        `<a rel="nofollow">x</a>`,
+	`<a href="https://other.example/">x</a>`:     `<a href="https://other.example/" rel="nofollow">x</a>`,
+}
+
 type badReader struct{}
 
 func (br badReader) Read(p []byte) (n int, err error) {
@@ -0,0 +1,216 @@
+package gsoup
+
+import (
+	"regexp"
+	"strings"
+)
+
+// cssDeclaration is a single property/value pair from a style attribute
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+func (d cssDeclaration) String() string {
+	if d.important {
+		return d.property + ": " + d.value + " !important"
+	}
+	return d.property + ": " + d.value
+}
+
+var cssPropertyPattern = regexp.MustCompile(`^-?[a-z][a-z0-9-]*$`)
+var cssImportantPattern = regexp.MustCompile(`(?i)\s*!\s*important$`)
+
+// parseStyle splits the value of a style attribute into its declarations. Comments are
+// discarded and malformed declarations are skipped
+func parseStyle(style string) (decls []cssDeclaration) {
+	for _, raw := range splitCSS(stripCSSComments(style), ';') {
+		colon := strings.IndexByte(raw, ':')
+		if colon < 0 {
+			continue
+		}
+		decl := cssDeclaration{
+			property: strings.ToLower(strings.TrimSpace(raw[:colon])),
+			value:    strings.TrimSpace(raw[colon+1:]),
+		}
+		if loc := cssImportantPattern.FindStringIndex(decl.value); loc != nil {
+			decl.value = strings.TrimSpace(decl.value[:loc[0]])
+			decl.important = true
+		}
+		decl.value = strings.Join(strings.Fields(decl.value), " ")
+		if !cssPropertyPattern.MatchString(decl.property) || decl.value == "" {
+			continue
+		}
+		decls = append(decls, decl)
+	}
+	return decls
+}
+
+// stripCSSComments removes /* */ comments outside of quoted strings. An unterminated
+// comment swallows the remainder of the input, as it would in a browser
+func stripCSSComments(s string) string {
+	var buf []byte
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return string(buf)
+			}
+			i += end + 3
+			continue
+		}
+		buf = append(buf, ch)
+	}
+	return string(buf)
+}
+
+// splitCSS splits s on sep, ignoring separators inside quotes and parentheses
+func splitCSS(s string, sep byte) (parts []string) {
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			if depth > 0 {
+				depth--
+			}
+		case ch == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// cssFunctions is the set of CSS functions permitted in declaration values
+var cssFunctions = map[string]struct{}{
+	"rgb":  struct{}{},
+	"rgba": struct{}{},
+	"hsl":  struct{}{},
+	"hsla": struct{}{},
+}
+
+// safeCSSValue reports whether a declaration value is free of constructs that can load
+// resources or execute script, e.g. url(), expression(), @import and escape sequences
+// that could be used to smuggle them past a property validator
+func safeCSSValue(value string) bool {
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if ch < 0x20 || ch == 0x7f {
+			return false
+		}
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			} else if strings.IndexByte("\\<>", ch) >= 0 {
+				return false
+			}
+			continue
+		}
+		switch ch {
+		case '"', '\'':
+			quote = ch
+		case '\\', '<', '>', ';', ':', '{', '}', '@', '!':
+			return false
+		case '(':
+			j := i
+			for j > 0 && isCSSIdentChar(value[j-1]) {
+				j--
+			}
+			if _, ok := cssFunctions[strings.ToLower(value[j:i])]; !ok {
+				return false
+			}
+		}
+	}
+	return quote == 0
+}
+
+func isCSSIdentChar(ch byte) bool {
+	return ch == '-' || ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
+
+// sanitizeStyle rewrites a style attribute value, retaining only declarations for
+// properties allowed by the tagdef whose values pass validation. The declarations
+// that were removed are also returned
+func sanitizeStyle(tagdef *Tagdef, style string) (string, []cssDeclaration) {
+	var kept []string
+	var removed []cssDeclaration
+	for _, decl := range parseStyle(style) {
+		if validStyle(tagdef, decl) {
+			kept = append(kept, decl.String())
+		} else {
+			removed = append(removed, decl)
+		}
+	}
+	return strings.Join(kept, "; "), removed
+}
+
+func validStyle(tagdef *Tagdef, decl cssDeclaration) bool {
+	validator, allowed := tagdef.AllowedStyles[decl.property]
+	if !allowed || !safeCSSValue(decl.value) {
+		return false
+	}
+	return validator == nil || validator.Validate(decl.value)
+}
+
+var cssLength = `(?:0|-?(?:[0-9]+|[0-9]*\.[0-9]+)(?:px|em|rem|ex|ch|%|pt|pc|cm|mm|in|vw|vh|vmin|vmax)|auto)`
+var cssLengthPattern = regexp.MustCompile(`(?i)` + cssLength)
+var cssBoxPattern = regexp.MustCompile(`(?i)` + cssLength + `(?: ` + cssLength + `){0,3}`)
+var cssFontSizePattern = regexp.MustCompile(`(?i)` + cssLength + `|xx-small|x-small|small|medium|large|x-large|xx-large|smaller|larger`)
+var cssFontFamilyPattern = regexp.MustCompile(`(?i)(?:[a-z0-9 -]+|"[a-z0-9 -]+"|'[a-z0-9 -]+')(?: ?, ?(?:[a-z0-9 -]+|"[a-z0-9 -]+"|'[a-z0-9 -]+'))*`)
+var cssTextDecorationPattern = regexp.MustCompile(`(?i)none|(?:underline|overline|line-through)(?: (?:underline|overline|line-through))*`)
+
+// cssPropertyValidators holds the built-in value validators applied by AllowStyles.
+// Properties without an entry here are only checked by safeCSSValue
+var cssPropertyValidators = map[string]AttrValidator{
+	"background-color": Color(),
+	"border-color":     Color(),
+	"color":            Color(),
+	"direction":        OneOf("ltr", "rtl"),
+	"float":            OneOf("left", "right", "none"),
+	"clear":            OneOf("left", "right", "both", "none"),
+	"font-family":      MatchRegexp(cssFontFamilyPattern),
+	"font-size":        MatchRegexp(cssFontSizePattern),
+	"font-style":       OneOf("normal", "italic", "oblique"),
+	"font-weight":      OneOf("normal", "bold", "bolder", "lighter", "100", "200", "300", "400", "500", "600", "700", "800", "900"),
+	"height":           MatchRegexp(cssLengthPattern),
+	"line-height":      MatchRegexp(regexp.MustCompile(`(?i)normal|[0-9]*\.?[0-9]+|` + cssLength)),
+	"list-style-type":  OneOf("none", "disc", "circle", "square", "decimal", "lower-alpha", "upper-alpha", "lower-roman", "upper-roman"),
+	"margin":           MatchRegexp(cssBoxPattern),
+	"margin-bottom":    MatchRegexp(cssLengthPattern),
+	"margin-left":      MatchRegexp(cssLengthPattern),
+	"margin-right":     MatchRegexp(cssLengthPattern),
+	"margin-top":       MatchRegexp(cssLengthPattern),
+	"padding":          MatchRegexp(cssBoxPattern),
+	"padding-bottom":   MatchRegexp(cssLengthPattern),
+	"padding-left":     MatchRegexp(cssLengthPattern),
+	"padding-right":    MatchRegexp(cssLengthPattern),
+	"padding-top":      MatchRegexp(cssLengthPattern),
+	"text-align":       OneOf("left", "right", "center", "justify", "start", "end"),
+	"text-decoration":  MatchRegexp(cssTextDecorationPattern),
+	"text-indent":      MatchRegexp(cssLengthPattern),
+	"text-transform":   OneOf("none", "capitalize", "uppercase", "lowercase"),
+	"vertical-align":   OneOf("baseline", "sub", "super", "top", "text-top", "middle", "bottom", "text-bottom"),
+	"white-space":      OneOf("normal", "nowrap", "pre", "pre-wrap", "pre-line"),
+	"width":            MatchRegexp(cssLengthPattern),
+}
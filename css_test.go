@@ -0,0 +1,97 @@
+package gsoup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html/atom"
+)
+
+func Test_parseStyle(t *testing.T) {
+	decls := parseStyle(` COLOR : Red ;text-align:center;; bogus ; font-family: "a;b", serif; margin: 0  auto !IMPORTANT `)
+	assert.Equal(t, []cssDeclaration{
+		{property: "color", value: "Red"},
+		{property: "text-align", value: "center"},
+		{property: "font-family", value: `"a;b", serif`},
+		{property: "margin", value: "0 auto", important: true},
+	}, decls)
+
+	assert.Nil(t, parseStyle(""))
+	assert.Nil(t, parseStyle("color:"))
+	assert.Nil(t, parseStyle("1color: red; co lor: red"))
+}
+
+func Test_stripCSSComments(t *testing.T) {
+	assert.Equal(t, "color: red", stripCSSComments("color:/* hi */ red"))
+	assert.Equal(t, "xss:expression(alert(1))", stripCSSComments("xss:ex/*XSS*//*/*/pression(alert(1))"))
+	assert.Equal(t, `content: "/* kept */"`, stripCSSComments(`content: "/* kept */"`))
+	assert.Equal(t, "color: red", stripCSSComments("color: red/* unterminated"))
+}
+
+func Test_safeCSSValue(t *testing.T) {
+	for _, safe := range []string{"red", "rgb(1, 2, 3)", "0 auto", `"Times New Roman", serif`, "12px"} {
+		assert.True(t, safeCSSValue(safe), "%s should be safe", safe)
+	}
+	for _, unsafe := range unsafeCSSValues {
+		assert.False(t, safeCSSValue(unsafe), "%s should not be safe", unsafe)
+	}
+}
+
+func Test_sanitizeStyle(t *testing.T) {
+	tdef := T(atom.P).AllowStyles("color", "text-align", "x-custom")
+
+	for raw, expected := range sanitizeStyleTests {
+		actual, _ := sanitizeStyle(tdef, raw)
+		assert.Equal(t, expected, actual)
+	}
+
+	_, removed := sanitizeStyle(tdef, "color: red; position: fixed; color: url(foo)")
+	assert.Equal(t, []cssDeclaration{{property: "position", value: "fixed"}, {property: "color", value: "url(foo)"}}, removed)
+}
+
+func Test_Clean_Styles(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.P).AllowStyles("color", "text-align"), T(atom.Span))
+
+	for input, expected := range styleTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+var unsafeCSSValues = []string{
+	"url(http://evil.com/x.png)",
+	"URL(http://evil.com/x.png)",
+	"expression(alert(1))",
+	"image-set(foo)",
+	"url (foo)",
+	`\75rl(foo)`,
+	`"\75rl(foo)"`,
+	"@import 'foo'",
+	"javascript:alert(1)",
+	"red; background: url(foo)",
+	"red}body{color:red",
+	"</style><script>",
+	`"unterminated`,
+	"red\x00",
+}
+
+var sanitizeStyleTests = map[string]string{
+	"color: red; text-align: center; position: fixed":   "color: red; text-align: center",
+	"color: url(javascript:alert(1)); text-align: left": "text-align: left",
+	"text-align: diagonal":                              "",
+	"x-custom: anything-safe":                           "x-custom: anything-safe",
+	"x-custom: expression(alert(1))":                    "",
+	"x-custom: ex/**/pression(alert(1))":                "",
+	`x-custom: \75 rl(evil)`:                            "",
+}
+
+var styleTests = map[string]string{
+	`<p style="color: red; text-align: center">x</p>`:                     `<p style="color: red; text-align: center">x</p>`,
+	`<p style="color: red; background: url(javascript:alert(1))">x</p>`:   `<p style="color: red">x</p>`,
+	`<p style="color: expression(alert(1))">x</p>`:                        `<p>x</p>`,
+	`<p style="text-align:right;color:#ABC !important">x</p>`:             `<p style="text-align: right; color: #ABC !important">x</p>`,
+	`<p style="color: rgb(1,2,3)" onclick="alert(1)">x</p>`:               `<p style="color: rgb(1,2,3)">x</p>`,
+	`<span style="color: red">x</span>`:                                   `<span>x</span>`,
+	`<p style="xss:ex/*XSS*//*/*/pression(alert(&quot;XSS&quot;))">x</p>`: `<p>x</p>`,
+}
@@ -0,0 +1,124 @@
+package gsoup
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DataURIPolicy restricts the data: URIs allowed in an attribute
+type DataURIPolicy struct {
+	// MediaTypes lists the allowed MIME types, e.g. "image/png". If empty, PNG, JPEG,
+	// GIF and WebP images are allowed. Beware of allowing types that can contain script,
+	// such as text/html or image/svg+xml
+	MediaTypes []string
+	// MaxBytes caps the size of the decoded payload. Zero means no limit
+	MaxBytes int
+	// Sniff requires the payload's content, as detected by http.DetectContentType, to
+	// match its declared media type
+	Sniff bool
+}
+
+// DataURImap encapsulates the data: URI policies applied to attribute values
+type DataURImap map[string]DataURIPolicy
+
+// defaultDataURIMediaTypes are the media types allowed by a DataURIPolicy without any
+var defaultDataURIMediaTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// defaultDataURIPolicy applies to attributes whose enforced protocols include "data" but
+// that have no DataURIPolicy of their own
+var defaultDataURIPolicy = DataURIPolicy{MaxBytes: 1 << 20, Sniff: true}
+
+// allows reports whether the canonicalized data: URI satisfies the policy
+func (p DataURIPolicy) allows(rawURL string) bool {
+	mediaType, payload, ok := parseDataURI(rawURL, p.MaxBytes)
+	if !ok {
+		return false
+	}
+
+	mediaTypes := p.MediaTypes
+	if len(mediaTypes) == 0 {
+		mediaTypes = defaultDataURIMediaTypes
+	}
+	allowed := false
+	for _, t := range mediaTypes {
+		if strings.ToLower(strings.TrimSpace(t)) == mediaType {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+
+	if p.MaxBytes > 0 && len(payload) > p.MaxBytes {
+		return false
+	}
+
+	if p.Sniff {
+		sniffed := http.DetectContentType(payload)
+		if i := strings.IndexByte(sniffed, ';'); i >= 0 {
+			sniffed = sniffed[:i]
+		}
+		return sniffed == mediaType
+	}
+	return true
+}
+
+// parseDataURI returns the lowercased media type and decoded payload of a data: URI of
+// the form data:[<mediatype>][;base64],<data>. If maxBytes is positive, URIs that are
+// certain to decode to more than maxBytes are rejected without being decoded
+func parseDataURI(rawURL string, maxBytes int) (mediaType string, payload []byte, ok bool) {
+	if urlScheme(rawURL) != "data" {
+		return "", nil, false
+	}
+	rest := rawURL[len("data:"):]
+	comma := strings.IndexByte(rest, ',')
+	if comma < 0 {
+		return "", nil, false
+	}
+	params := strings.Split(rest[:comma], ";")
+	data := rest[comma+1:]
+
+	mediaType = strings.ToLower(strings.TrimSpace(params[0]))
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+
+	isBase64 := len(params) > 1 && strings.EqualFold(strings.TrimSpace(params[len(params)-1]), "base64")
+	if maxBytes > 0 && minDecodedLen(data, isBase64) > maxBytes {
+		return "", nil, false
+	}
+
+	var err error
+	if isBase64 {
+		data, err = url.PathUnescape(data)
+		if err != nil {
+			return "", nil, false
+		}
+		payload, err = base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			payload, err = base64.RawStdEncoding.DecodeString(data)
+		}
+	} else {
+		var unescaped string
+		unescaped, err = url.PathUnescape(data)
+		payload = []byte(unescaped)
+	}
+	if err != nil {
+		return "", nil, false
+	}
+	return mediaType, payload, true
+}
+
+// minDecodedLen returns a lower bound on the size of the payload encoded by data, which
+// is percent-encoded and optionally base64 encoded. Each escape shrinks to one byte, and
+// base64 padding accounts for at most two bytes
+func minDecodedLen(data string, isBase64 bool) int {
+	n := len(data) - 2*strings.Count(data, "%")
+	if isBase64 {
+		n = base64.StdEncoding.DecodedLen(n) - 2
+	}
+	return n
+}
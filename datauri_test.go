@@ -0,0 +1,126 @@
+package gsoup
+
+import (
+	"encoding/base64"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html/atom"
+)
+
+const pngDataURI = "data:image/png;base64,iVBORw0KGgowMDAw"
+const gifDataURI = "data:image/gif;base64,R0lGODlhMDAwMA=="
+
+func Test_parseDataURI(t *testing.T) {
+	mediaType, payload, ok := parseDataURI(pngDataURI, 0)
+	assert.True(t, ok)
+	assert.Equal(t, "image/png", mediaType)
+	assert.Equal(t, []byte("\x89PNG\r\n\x1a\n0000"), payload)
+
+	mediaType, payload, ok = parseDataURI("DATA:,Hello%2C%20World", 0)
+	assert.True(t, ok)
+	assert.Equal(t, "text/plain", mediaType)
+	assert.Equal(t, []byte("Hello, World"), payload)
+
+	mediaType, _, ok = parseDataURI("data:Image/GIF;name=x.gif;BASE64,R0lGODlhMDAwMA", 0)
+	assert.True(t, ok)
+	assert.Equal(t, "image/gif", mediaType)
+
+	_, _, ok = parseDataURI("data:image/png;base64", 0)
+	assert.False(t, ok)
+	_, _, ok = parseDataURI("data:image/png;base64,!!!", 0)
+	assert.False(t, ok)
+	_, _, ok = parseDataURI("http://example.com/a.png", 0)
+	assert.False(t, ok)
+}
+
+func Test_parseDataURI_maxBytes(t *testing.T) {
+	huge := "data:image/png;base64," + strings.Repeat("AAAA", 1<<19)
+	_, payload, ok := parseDataURI(huge, 1<<20)
+	assert.False(t, ok)
+	assert.Nil(t, payload)
+	_, payload, ok = parseDataURI(huge, 3<<19)
+	assert.True(t, ok)
+	assert.Equal(t, 3<<19, len(payload))
+
+	_, _, ok = parseDataURI("data:,"+strings.Repeat("a", 11), 10)
+	assert.False(t, ok)
+	_, _, ok = parseDataURI("data:,"+strings.Repeat("%61", 10), 10)
+	assert.True(t, ok)
+}
+
+func Test_minDecodedLen(t *testing.T) {
+	for _, data := range []string{"", "QQ==", "QUI=", "QUJD", "QUJDRA", "QUJD%52A%3D%3D", "R0lGODlhMDAwMA=="} {
+		payload, err := base64.StdEncoding.DecodeString(mustUnescape(data))
+		if err != nil {
+			payload, _ = base64.RawStdEncoding.DecodeString(mustUnescape(data))
+		}
+		assert.True(t, minDecodedLen(data, true) <= len(payload), data)
+	}
+	assert.Equal(t, 3, minDecodedLen("a%20b", false))
+}
+
+func mustUnescape(s string) string {
+	unescaped, err := url.PathUnescape(s)
+	if err != nil {
+		panic(err)
+	}
+	return unescaped
+}
+
+func Test_DataURIPolicy_allows(t *testing.T) {
+	assert.True(t, DataURIPolicy{}.allows(pngDataURI))
+	assert.True(t, DataURIPolicy{}.allows(gifDataURI))
+	assert.False(t, DataURIPolicy{}.allows("data:text/html,<script>alert(1)</script>"))
+	assert.False(t, DataURIPolicy{}.allows("data:image/svg+xml;base64,PHN2ZyBvbmxvYWQ9YWxlcnQoMSk+"))
+
+	assert.True(t, DataURIPolicy{MediaTypes: []string{"image/gif"}}.allows(gifDataURI))
+	assert.False(t, DataURIPolicy{MediaTypes: []string{"image/gif"}}.allows(pngDataURI))
+
+	assert.True(t, DataURIPolicy{MaxBytes: 12}.allows(pngDataURI))
+	assert.False(t, DataURIPolicy{MaxBytes: 11}.allows(pngDataURI))
+
+	// a GIF payload declared as a PNG is only caught by sniffing
+	mislabeled := "data:image/png;base64,R0lGODlhMDAwMA=="
+	assert.True(t, DataURIPolicy{}.allows(mislabeled))
+	assert.False(t, DataURIPolicy{Sniff: true}.allows(mislabeled))
+	assert.True(t, DataURIPolicy{Sniff: true}.allows(pngDataURI))
+}
+
+func Test_AllowDataURIs(t *testing.T) {
+	types := []string{"image/png"}
+	tdef := T(atom.Img, "src").AllowDataURIs("SRC", DataURIPolicy{MediaTypes: types, MaxBytes: 100})
+	types[0] = "text/html"
+
+	assert.True(t, reflect.DeepEqual(DataURImap{"src": DataURIPolicy{MediaTypes: []string{"image/png"}, MaxBytes: 100}}, tdef.AllowedDataURIs))
+	assert.True(t, reflect.DeepEqual(tdef, cloneTagdef(tdef)))
+}
+
+func Test_Clean_DataURIs(t *testing.T) {
+	c := NewBasicCleanerWithImages().AddTags(
+		T(atom.Img, "src", "srcset").
+			EnforceProtocols("src", "https").
+			AllowDataURIs("src", DataURIPolicy{MaxBytes: 1024, Sniff: true}),
+		T(atom.Video, "poster").EnforceProtocols("poster", "https", "data"),
+	)
+
+	for input, expected := range dataURITests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+var dataURITests = map[string]string{
+	`<img src="` + pngDataURI + `">`:                                                  `<img src="` + pngDataURI + `"/>`,
+	`<img src="data:text/html,<script>alert(1)</script>">`:                            `<img/>`,
+	`<img src="data:image/png;base64,R0lGODlhMDAwMA==">`:                              `<img/>`,
+	`<img src="https://example.com/a.png">`:                                           `<img src="https://example.com/a.png"/>`,
+	`<img srcset="` + pngDataURI + ` 1x, https://example.com/a.png 2x">`:              `<img srcset="https://example.com/a.png 2x"/>`,
+	`<video poster="` + gifDataURI + `"></video>`:                                     `<video poster="` + gifDataURI + `"></video>`,
+	`<video poster="data:image/svg+xml;base64,PHN2ZyBvbmxvYWQ9YWxlcnQoMSk+"></video>`: `<video></video>`,
+	`<a href="` + pngDataURI + `">x</a>`:                                              `<a rel="nofollow">x</a>`,
+}
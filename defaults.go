@@ -1,6 +1,44 @@
 package gsoup
 
-import "golang.org/x/net/html/atom"
+import (
+	"math"
+	"regexp"
+
+	"golang.org/x/net/html/atom"
+)
+
+// listTypePattern matches the case-sensitive values of <ol type>
+var listTypePattern = regexp.MustCompile(`[1aAiI]`)
+
+// langPattern matches BCP 47 language tags
+var langPattern = regexp.MustCompile(`[a-zA-Z]{1,8}(?:-[a-zA-Z0-9]{1,8})*`)
+
+// charsetPattern matches character encoding labels
+var charsetPattern = regexp.MustCompile(`[a-zA-Z0-9._:-]{1,40}`)
+
+// urlAttrs are the attributes whose values are URLs. Unless a Tagdef enforces its own
+// protocols on them, the cleaner's default protocols are enforced
+var urlAttrs = Attrset{
+	"action":     struct{}{},
+	"background": struct{}{},
+	"cite":       struct{}{},
+	"formaction": struct{}{},
+	"href":       struct{}{},
+	"longdesc":   struct{}{},
+	"poster":     struct{}{},
+	"src":        struct{}{},
+	"srcset":     struct{}{},
+	"usemap":     struct{}{},
+	"xlink:href": struct{}{},
+}
+
+// defaultURLProtocols are the protocols allowed in URL attributes by default
+var defaultURLProtocols = Protoset{
+	"ftp":    struct{}{},
+	"http":   struct{}{},
+	"https":  struct{}{},
+	"mailto": struct{}{},
+}
 
 var simpleTextWhitelist = whitelist{
 	atom.B:      T(atom.B),
@@ -47,7 +85,7 @@ var basicWhitelistWithImages = whitelist{
 	atom.Dt:         T(atom.Dt),
 	atom.Em:         T(atom.Em),
 	atom.I:          T(atom.I),
-	atom.Img:        T(atom.Img, "align", "alt", "height", "src", "title", "width").EnforceProtocols("src", "http", "https"),
+	atom.Img:        T(atom.Img, "align", "alt", "height", "sizes", "src", "srcset", "title", "width").EnforceProtocols("src", "http", "https").EnforceProtocols("srcset", "http", "https").ValidateAttr("sizes", MatchRegexp(sizesPattern)).ValidateAttr("align", OneOf("left", "right", "top", "middle", "bottom")).ValidateAttr("height", Dimension()).ValidateAttr("width", Dimension()),
 	atom.Li:         T(atom.Li),
 	atom.Ol:         T(atom.Ol),
 	atom.P:          T(atom.P),
@@ -71,8 +109,8 @@ var relaxedWhitelist = whitelist{
 	atom.Caption:    T(atom.Caption),
 	atom.Cite:       T(atom.Cite),
 	atom.Code:       T(atom.Code),
-	atom.Col:        T(atom.Col, "span", "width"),
-	atom.Colgroup:   T(atom.Colgroup, "span", "width"),
+	atom.Col:        T(atom.Col, "span", "width").ValidateAttr("span", IntegerRange(1, 1000)).ValidateAttr("width", Dimension()),
+	atom.Colgroup:   T(atom.Colgroup, "span", "width").ValidateAttr("span", IntegerRange(1, 1000)).ValidateAttr("width", Dimension()),
 	atom.Dd:         T(atom.Dd),
 	atom.Div:        T(atom.Div),
 	atom.Dl:         T(atom.Dl),
@@ -85,9 +123,9 @@ var relaxedWhitelist = whitelist{
 	atom.H5:         T(atom.H5),
 	atom.H6:         T(atom.H6),
 	atom.I:          T(atom.I),
-	atom.Img:        T(atom.Img, "align", "alt", "height", "src", "title", "width").EnforceProtocols("src", "http", "https"),
+	atom.Img:        T(atom.Img, "align", "alt", "height", "sizes", "src", "srcset", "title", "width").EnforceProtocols("src", "http", "https").EnforceProtocols("srcset", "http", "https").ValidateAttr("sizes", MatchRegexp(sizesPattern)).ValidateAttr("align", OneOf("left", "right", "top", "middle", "bottom")).ValidateAttr("height", Dimension()).ValidateAttr("width", Dimension()),
 	atom.Li:         T(atom.Li),
-	atom.Ol:         T(atom.Ol, "start", "type"),
+	atom.Ol:         T(atom.Ol, "start", "type").ValidateAttr("start", IntegerRange(math.MinInt32, math.MaxInt32)).ValidateAttr("type", MatchRegexp(listTypePattern)),
 	atom.P:          T(atom.P),
 	atom.Pre:        T(atom.Pre),
 	atom.Q:          T(atom.Q, "cite").EnforceProtocols("cite", "http", "https"),
@@ -97,15 +135,24 @@ var relaxedWhitelist = whitelist{
 	atom.Strong:     T(atom.Strong),
 	atom.Sub:        T(atom.Sub),
 	atom.Sup:        T(atom.Sup),
-	atom.Table:      T(atom.Table, "summary", "width"),
+	atom.Table:      T(atom.Table, "summary", "width").ValidateAttr("width", Dimension()),
 	atom.Tbody:      T(atom.Tbody),
-	atom.Td:         T(atom.Td, "abbr", "axis", "colspan", "rowspan", "width"),
+	atom.Td:         T(atom.Td, "abbr", "axis", "colspan", "rowspan", "width").ValidateAttr("colspan", IntegerRange(1, 1000)).ValidateAttr("rowspan", IntegerRange(0, 65534)).ValidateAttr("width", Dimension()),
 	atom.Tfoot:      T(atom.Tfoot),
-	atom.Th:         T(atom.Th, "abbr", "axis", "colspan", "rowspan", "scope", "width"),
+	atom.Th:         T(atom.Th, "abbr", "axis", "colspan", "rowspan", "scope", "width").ValidateAttr("colspan", IntegerRange(1, 1000)).ValidateAttr("rowspan", IntegerRange(0, 65534)).ValidateAttr("scope", OneOf("row", "col", "rowgroup", "colgroup")).ValidateAttr("width", Dimension()),
 	atom.Thead:      T(atom.Thead),
 	atom.Tr:         T(atom.Tr),
 	atom.U:          T(atom.U),
-	atom.Ul:         T(atom.Ul, "type"),
+	atom.Ul:         T(atom.Ul, "type").ValidateAttr("type", OneOf("disc", "circle", "square")),
+}
+
+// documentWhitelist holds the document structure retained by cleaners in document mode
+var documentWhitelist = whitelist{
+	atom.Html:  T(atom.Html, "lang", "dir").ValidateAttr("lang", MatchRegexp(langPattern)).ValidateAttr("dir", OneOf("ltr", "rtl", "auto")),
+	atom.Head:  T(atom.Head),
+	atom.Title: T(atom.Title),
+	atom.Meta:  T(atom.Meta, "charset", "name", "content").ValidateAttr("charset", MatchRegexp(charsetPattern)).ValidateAttr("name", OneOf("application-name", "author", "description", "generator", "keywords", "viewport")).ValidateAttr("content", MaxLength(1024)),
+	atom.Body:  T(atom.Body),
 }
 
 var deleteChildrenSet = Tagset{
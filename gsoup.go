@@ -1,6 +1,10 @@
 package gsoup
 
-import "golang.org/x/net/html/atom"
+import (
+	"strings"
+
+	"golang.org/x/net/html/atom"
+)
 
 // NewEmptyCleaner creates a cleaner with no allowed tags
 func NewEmptyCleaner() Cleaner {
@@ -41,3 +45,14 @@ func T(tag atom.Atom, attrs ...string) (def *Tagdef) {
 	}
 	return def
 }
+
+// TName is a shorthand method for creating a new Tagdef from a tag name. Names without
+// an atom, such as custom elements (e.g. "x-mention"), are recorded in the Tagdef's Name
+func TName(name string, attrs ...string) (def *Tagdef) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	def = T(atom.Lookup([]byte(name)), attrs...)
+	if def.Tag == 0 {
+		def.Name = name
+	}
+	return def
+}
@@ -56,3 +56,15 @@ func Test_RelaxedCleaner(t *testing.T) {
 	c := NewRelaxedCleaner().(*cleaner)
 	assert.True(t, reflect.DeepEqual(c.w, relaxedWhitelist))
 }
+
+func Test_TName(t *testing.T) {
+	def := TName(" X-Mention ", "data-user")
+	assert.Equal(t, atom.Atom(0), def.Tag)
+	assert.Equal(t, "x-mention", def.Name)
+	_, ok := def.AllowedAttrs["data-user"]
+	assert.True(t, ok, "'data-user' should be an attribute")
+
+	def = TName("DIV", "id")
+	assert.Equal(t, atom.Div, def.Tag, "names with an atom should set the Tag")
+	assert.Equal(t, "", def.Name)
+}
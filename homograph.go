@@ -0,0 +1,150 @@
+package gsoup
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/idna"
+)
+
+// HomographAction determines what happens to a URL whose host could be mistaken for
+// another, e.g. "https://аpple.com" with a Cyrillic "а"
+type HomographAction int
+
+const (
+	// HomographDrop removes the attribute containing the URL
+	HomographDrop HomographAction = iota
+	// HomographPunycode converts the host to punycode, revealing its true name
+	HomographPunycode
+	// HomographWarn retains the URL, recording a warning in the cleaning report
+	HomographWarn
+)
+
+// scriptCombinations are the combinations of scripts, besides Latin, that may be mixed
+// within a domain label. These are used together in Chinese, Japanese and Korean
+var scriptCombinations = []map[string]struct{}{
+	{"Han": struct{}{}, "Hiragana": struct{}{}, "Katakana": struct{}{}},
+	{"Han": struct{}{}, "Bopomofo": struct{}{}},
+	{"Han": struct{}{}, "Hangul": struct{}{}},
+}
+
+// latinLookalikes are Cyrillic and Greek letters that are indistinguishable from Latin
+// letters in most fonts. A label made up entirely of them can impersonate a Latin one
+var latinLookalikes = map[string]string{
+	"Cyrillic": "аеорсухіјѕԁһӏԛԝҽ",
+	"Greek":    "αοτνιυκρε",
+}
+
+// confusableHost reports whether any label of host mixes scripts that are not normally
+// used together, or consists entirely of letters that look like Latin letters. Hosts in
+// punycode are decoded first
+func confusableHost(host string) bool {
+	if decoded, err := idna.Punycode.ToUnicode(host); err == nil {
+		host = decoded
+	}
+	for _, label := range strings.Split(strings.ToLower(host), ".") {
+		scripts := labelScripts(label)
+		if len(scripts) > 1 && !allowedScriptMix(scripts) {
+			return true
+		}
+		if len(scripts) == 1 && lookalikeLabel(label, scripts) {
+			return true
+		}
+	}
+	return false
+}
+
+// labelScripts returns the scripts of the letters in label, ignoring characters common
+// to all scripts such as digits and hyphens
+func labelScripts(label string) map[string]struct{} {
+	scripts := make(map[string]struct{})
+	for _, r := range label {
+		if r < 0x80 {
+			if unicode.IsLetter(r) {
+				scripts["Latin"] = struct{}{}
+			}
+			continue
+		}
+		for name, table := range unicode.Scripts {
+			if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+				scripts[name] = struct{}{}
+				break
+			}
+		}
+	}
+	return scripts
+}
+
+func allowedScriptMix(scripts map[string]struct{}) bool {
+	for _, allowed := range scriptCombinations {
+		ok := true
+		for script := range scripts {
+			if _, found := allowed[script]; !found && script != "Latin" {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func lookalikeLabel(label string, scripts map[string]struct{}) bool {
+	for script, lookalikes := range latinLookalikes {
+		if _, ok := scripts[script]; !ok {
+			continue
+		}
+		for _, r := range label {
+			if unicode.IsLetter(r) && !strings.ContainsRune(lookalikes, r) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// checkHomographs applies the cleaner's homograph action to the URLs in a validated
+// attribute value, returning "" if the attribute should be removed
+func (c *cleaner) checkHomographs(n *html.Node, attrKey string, attrVal string, r *Report) string {
+	if attrKey != "srcset" {
+		return c.checkHomograph(n, attrKey, attrVal, r)
+	}
+
+	var kept []string
+	for _, candidate := range parseSrcset(attrVal) {
+		candidate.url = c.checkHomograph(n, attrKey, candidate.url, r)
+		if candidate.url != "" {
+			kept = append(kept, candidate.String())
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+func (c *cleaner) checkHomograph(n *html.Node, attrKey string, rawURL string, r *Report) string {
+	u, err := parseURL(rawURL)
+	if err != nil || !confusableHost(u.Hostname()) {
+		return rawURL
+	}
+
+	switch c.homographAction {
+	case HomographDrop:
+		return ""
+	case HomographPunycode:
+		host, err := idna.Punycode.ToASCII(strings.ToLower(u.Hostname()))
+		if err != nil {
+			return ""
+		}
+		if port := u.Port(); port != "" {
+			host += ":" + port
+		}
+		u.Host = host
+		return u.String()
+	}
+
+	r.warn(n, Warning{Reason: ReasonConfusableHost, Name: attrKey, Value: rawURL})
+	return rawURL
+}
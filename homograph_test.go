@@ -0,0 +1,81 @@
+package gsoup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_confusableHost(t *testing.T) {
+	for host, expected := range confusableHostTests {
+		assert.Equal(t, expected, confusableHost(host), host)
+	}
+}
+
+func Test_Clean_CheckHomographs(t *testing.T) {
+	for action, tests := range homographTests {
+		c := NewBasicCleanerWithImages().CheckHomographs(action)
+		for input, expected := range tests {
+			actual, err := c.CleanString(input)
+			assert.Nil(t, err, "unexpected error: %v", err)
+			assert.Equal(t, expected, actual)
+		}
+	}
+
+	_, report, err := NewBasicCleaner().CheckHomographs(HomographWarn).CleanWithReport(strings.NewReader(`<p><a href="https://аpple.com/">x</a></p>`))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(report.Removals))
+	assert.Equal(t, []Warning{{Reason: ReasonConfusableHost, Name: "href", Value: "https://%D0%B0pple.com/", Path: "html/body/p/a"}}, report.Warnings)
+
+	_, report, err = NewBasicCleaner().CheckHomographs(HomographDrop).CleanWithReport(strings.NewReader(`<a href="https://аpple.com/">x</a>`))
+	assert.Nil(t, err)
+	assert.Equal(t, []Removal{{Kind: RemovedAttribute, Reason: ReasonConfusableHost, Name: "href", Value: "https://аpple.com/", Path: "html/body/a"}}, report.Removals)
+
+	// the host is found as browsers do, whatever the number of slashes
+	c := NewBasicCleaner().CheckHomographs(HomographDrop).(*cleaner)
+	assert.Equal(t, "", c.checkHomograph(nil, "href", "https:аpple.com/x", nil))
+	assert.Equal(t, "https:apple.com/x", c.checkHomograph(nil, "href", "https:apple.com/x", nil))
+
+	// warnings are not violations
+	assert.Nil(t, NewBasicCleaner().CheckHomographs(HomographWarn).Validate(strings.NewReader(`<a href="https://аpple.com/">x</a>`)))
+}
+
+var confusableHostTests = map[string]bool{
+	"apple.com":             false,
+	"xn--80ak6aa92e.com":    true, // аррӏе.com, all Cyrillic lookalikes
+	"аррӏе.com":             true,
+	"аpple.com":             true, // Cyrillic а with Latin
+	"xn--pple-43d.com":      true,
+	"яндекс.рф":             false,
+	"bücher.example":        false,
+	"東京abc.jp":              false,
+	"ひらがなカタカナ漢字.jp":         false,
+	"한국어中文.kr":              false,
+	"한국어ひらがな.kr":            true,
+	"ελληνικά.gr":           false,
+	"ορτ.com":               true,
+	"παypal.com":            true,
+	"123-456.example":       false,
+	"":                      false,
+	"example.com.":          false,
+	"xn--invalid-punycode-": false,
+}
+
+var homographTests = map[HomographAction]map[string]string{
+	HomographDrop: {
+		`<a href="https://аpple.com/">x</a>`:                                    `<a rel="nofollow">x</a>`,
+		`<a href="https://apple.com/">x</a>`:                                    `<a href="https://apple.com/" rel="nofollow">x</a>`,
+		`<a href="https:аpple.com/x">x</a>`:                                     `<a rel="nofollow">x</a>`,
+		`<img srcset="https://аpple.com/a.png 1x, https://apple.com/b.png 2x">`: `<img srcset="https://apple.com/b.png 2x"/>`,
+	},
+	HomographPunycode: {
+		`<a href="https://аpple.com:8080/x">x</a>`: `<a href="https://xn--pple-43d.com:8080/x" rel="nofollow">x</a>`,
+		`<a href="https://bücher.example/">x</a>`:  `<a href="https://b%C3%BCcher.example/" rel="nofollow">x</a>`,
+		`<a href="https:аpple.com/x">x</a>`:        `<a href="https://xn--pple-43d.com/x" rel="nofollow">x</a>`,
+	},
+	HomographWarn: {
+		`<a href="https://аpple.com/">x</a>`: `<a href="https://%D0%B0pple.com/" rel="nofollow">x</a>`,
+		`<a href="https:аpple.com/x">x</a>`:  `<a href="https://%D0%B0pple.com/x" rel="nofollow">x</a>`,
+	},
+}
@@ -0,0 +1,144 @@
+package gsoup
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// LinkPolicy controls the rel and target attributes of links (<a> and <area>). When a
+// cleaner has a link policy, it supersedes any rel or target attributes enforced or
+// allowed by the whitelist
+type LinkPolicy struct {
+	// InternalHosts are host patterns (as for Hostset) of internal links. Links without a
+	// host, e.g. relative links, are always internal
+	InternalHosts []string
+	// ExternalRel are the rel tokens added to external links. If nil, "nofollow ugc" is
+	// added; use an empty slice to add nothing
+	ExternalRel []string
+	// AllowedRel are the rel tokens retained from the input, e.g. "author" or "tag"
+	AllowedRel []string
+	// AllowTargetBlank retains target="_blank", adding "noopener noreferrer" to the link's
+	// rel. Other targets are always removed
+	AllowTargetBlank bool
+}
+
+// defaultExternalRel are the rel tokens added to external links by default
+var defaultExternalRel = []string{"nofollow", "ugc"}
+
+// linkRules is a LinkPolicy prepared for use by a cleaner
+type linkRules struct {
+	internalHosts    Hostset
+	externalRel      []string
+	allowedRel       map[string]struct{}
+	allowTargetBlank bool
+}
+
+func newLinkRules(policy LinkPolicy) *linkRules {
+	rules := &linkRules{
+		internalHosts:    addHosts(nil, policy.InternalHosts),
+		externalRel:      relTokens(nil, strings.Join(policy.ExternalRel, " ")),
+		allowedRel:       make(map[string]struct{}),
+		allowTargetBlank: policy.AllowTargetBlank,
+	}
+	if policy.ExternalRel == nil {
+		rules.externalRel = defaultExternalRel
+	}
+	for _, token := range relTokens(nil, strings.Join(policy.AllowedRel, " ")) {
+		rules.allowedRel[token] = struct{}{}
+	}
+	return rules
+}
+
+// isLink reports whether the link policy applies to the element n
+func isLink(n *html.Node) bool {
+	return n.DataAtom == atom.A || n.DataAtom == atom.Area
+}
+
+// isLinkAttr reports whether the link policy controls the attribute
+func isLinkAttr(key string) bool {
+	return key == "rel" || key == "target"
+}
+
+// apply sets the rel and target attributes of the link n, given its cleaned attrs and
+// the rel and target attributes it originally had. Disallowed input is recorded in r
+func (l *linkRules) apply(n *html.Node, attrs []html.Attribute, input []html.Attribute, r *Report) []html.Attribute {
+	var rel []string
+	blank := false
+	for _, attr := range input {
+		switch normalizeAttrKey(attr.Key) {
+		case "rel":
+			// tokens are de-duplicated, so repeating an allowed token isn't a removal
+			tokens := relTokens(nil, attr.Val)
+			kept := 0
+			for _, token := range tokens {
+				if _, ok := l.allowedRel[token]; ok {
+					rel = relTokens(rel, token)
+					kept++
+				}
+			}
+			if kept < len(tokens) {
+				r.removeAttr(n, attr, ReasonNotAllowed)
+			}
+		case "target":
+			if l.allowTargetBlank && strings.EqualFold(strings.TrimSpace(attr.Val), "_blank") {
+				blank = true
+			} else {
+				r.removeAttr(n, attr, ReasonNotAllowed)
+			}
+		}
+	}
+
+	if l.external(attrs) {
+		rel = relTokens(rel, strings.Join(l.externalRel, " "))
+	}
+	if blank {
+		attrs = append(attrs, html.Attribute{Key: "target", Val: "_blank"})
+		rel = relTokens(rel, "noopener noreferrer")
+	}
+	if len(rel) > 0 {
+		attrs = append(attrs, html.Attribute{Key: "rel", Val: strings.Join(rel, " ")})
+	}
+	return attrs
+}
+
+// external reports whether the href in attrs points to a host that isn't internal. The host
+// is the one browsers use, and special-scheme URLs without one count as external
+func (l *linkRules) external(attrs []html.Attribute) bool {
+	for _, attr := range attrs {
+		if attr.Key != "href" {
+			continue
+		}
+		u, err := parseURL(attr.Val)
+		if err != nil {
+			return false
+		}
+		host := normalizeHost(u.Hostname())
+		if host == "" {
+			// a special scheme without a host is unusual enough not to be trusted
+			_, special := specialSchemes[strings.ToLower(u.Scheme)]
+			return special
+		}
+		return !l.internalHosts.matches(host)
+	}
+	return false
+}
+
+// relTokens appends the lowercased, space-separated tokens of rel to tokens, skipping
+// any already present
+func relTokens(tokens []string, rel string) []string {
+	for _, token := range strings.Fields(strings.ToLower(rel)) {
+		found := false
+		for _, t := range tokens {
+			if t == token {
+				found = true
+				break
+			}
+		}
+		if !found {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
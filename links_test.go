@@ -0,0 +1,109 @@
+package gsoup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func Test_relTokens(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, relTokens([]string{"a"}, " B\tc  a b "))
+	assert.Nil(t, relTokens(nil, "  "))
+}
+
+func Test_newLinkRules(t *testing.T) {
+	rules := newLinkRules(LinkPolicy{})
+	assert.Equal(t, []string{"nofollow", "ugc"}, rules.externalRel)
+
+	rules = newLinkRules(LinkPolicy{ExternalRel: []string{}, AllowedRel: []string{"Author", "tag author"}, InternalHosts: []string{".Example.com"}})
+	assert.Nil(t, rules.externalRel)
+	assert.Equal(t, map[string]struct{}{"author": struct{}{}, "tag": struct{}{}}, rules.allowedRel)
+	assert.Equal(t, Hostset{".example.com": struct{}{}}, rules.internalHosts)
+}
+
+func Test_linkRules_apply_duplicateTokens(t *testing.T) {
+	doc, _ := html.Parse(strings.NewReader(`<a href="/">x</a>`))
+	a := doc.FirstChild.LastChild.FirstChild
+	r := newReport(doc)
+	rules := newLinkRules(LinkPolicy{AllowedRel: []string{"author", "nofollow"}})
+
+	attrs := rules.apply(a, []html.Attribute{{Key: "href", Val: "/"}}, []html.Attribute{
+		{Key: "rel", Val: "nofollow nofollow"},
+		{Key: "rel", Val: "Author author NOFOLLOW"},
+	}, r)
+	assert.Equal(t, []html.Attribute{{Key: "href", Val: "/"}, {Key: "rel", Val: "nofollow author"}}, attrs)
+	assert.Empty(t, r.Removals)
+
+	rules.apply(a, nil, []html.Attribute{{Key: "rel", Val: "author nofollow"}, {Key: "rel", Val: "me me"}}, r)
+	assert.Equal(t, []Removal{{Kind: RemovedAttribute, Reason: ReasonNotAllowed, Name: "rel", Value: "me me", Path: "html/body/a"}}, r.Removals)
+}
+
+func Test_linkRules_external(t *testing.T) {
+	rules := newLinkRules(LinkPolicy{InternalHosts: []string{".example.com"}})
+	for href, expected := range externalLinkTests {
+		assert.Equal(t, expected, rules.external([]html.Attribute{{Key: "href", Val: href}}), href)
+	}
+}
+
+func Test_Clean_LinkPolicy(t *testing.T) {
+	c := NewBasicCleaner().
+		AddTags(
+			T(atom.A, "href").EnforceAttr("rel", "nofollow").EnforceProtocols("href", "http", "https").AllowRelativeLinks(),
+			T(atom.Area, "href", "alt"),
+		).
+		WithLinkPolicy(LinkPolicy{
+			InternalHosts:    []string{".example.com"},
+			AllowedRel:       []string{"author", "tag"},
+			AllowTargetBlank: true,
+		})
+
+	for input, expected := range linkPolicyTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+
+	_, report, err := c.CleanWithReport(strings.NewReader(`<a href="/" rel="author me" target="_top">x</a>`))
+	assert.Nil(t, err)
+	assert.Equal(t, []Removal{
+		{Kind: RemovedAttribute, Reason: ReasonNotAllowed, Name: "rel", Value: "author me", Path: "html/body/a"},
+		{Kind: RemovedAttribute, Reason: ReasonNotAllowed, Name: "target", Value: "_top", Path: "html/body/a"},
+	}, report.Removals)
+
+	// without AllowTargetBlank, targets are always removed
+	c.WithLinkPolicy(LinkPolicy{ExternalRel: []string{"nofollow"}})
+	actual, err := c.CleanString(`<a href="https://other.example/" rel="tag" target="_blank">x</a>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<a href="https://other.example/" rel="nofollow">x</a>`, actual)
+}
+
+var linkPolicyTests = map[string]string{
+	`<a href="/about">x</a>`:                                          `<a href="/about">x</a>`,
+	`<a href="https://www.example.com/">x</a>`:                        `<a href="https://www.example.com/">x</a>`,
+	`<a href="https://other.example/">x</a>`:                          `<a href="https://other.example/" rel="nofollow ugc">x</a>`,
+	`<a href="https://other.example/" rel="AUTHOR nofollow me">x</a>`: `<a href="https://other.example/" rel="author nofollow ugc">x</a>`,
+	`<a href="/tags/go" rel="tag">x</a>`:                              `<a href="/tags/go" rel="tag">x</a>`,
+	`<a href="https://other.example/" target="_BLANK">x</a>`:          `<a href="https://other.example/" target="_blank" rel="nofollow ugc noopener noreferrer">x</a>`,
+	`<a href="/about" target="_blank" rel="opener">x</a>`:             `<a href="/about" target="_blank" rel="noopener noreferrer">x</a>`,
+	`<a href="/about" target="evil">x</a>`:                            `<a href="/about">x</a>`,
+	`<a name="anchor" rel="tag">x</a>`:                                `<a rel="tag">x</a>`,
+	`<area href="https://other.example/" alt="x">`:                    `<area href="https://other.example/" alt="x" rel="nofollow ugc"/>`,
+	`<a href="https:evil.example" target="_blank">x</a>`:              `<a href="https://evil.example" target="_blank" rel="nofollow ugc noopener noreferrer">x</a>`,
+	`<a href="http:/www.example.com/">x</a>`:                          `<a href="http://www.example.com/">x</a>`,
+}
+
+var externalLinkTests = map[string]bool{
+	"/about":                  false,
+	"https://www.example.com": false,
+	"https:www.example.com/x": false,
+	"mailto:a@example.com":    false,
+	"https://evil.example":    true,
+	"https:evil.example":      true,
+	"http:/evil.example/x":    true,
+	"HTTPS:///evil.example":   true,
+	"//evil.example/x":        true,
+	"https:":                  true,
+}
@@ -0,0 +1,163 @@
+package gsoup
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Policy is an immutable set of cleaning rules compiled from a Cleaner. Lookups such as
+// attribute pattern matching and the protocol rules of URL attributes are precomputed
+// when it is compiled. Because a Policy cannot be reconfigured, it is safe for concurrent
+// use by multiple goroutines
+type Policy struct {
+	c *cleaner
+}
+
+// Clean sanizitizes HTML input based on the policy's rules
+func (p *Policy) Clean(input io.Reader) (*html.Node, error) {
+	return p.c.Clean(input)
+}
+
+// CleanNode sanitizes HTML in an already constructed document. NOTE: This call is
+// destructive to the input param. The returned node will be wrapped in a
+// DocumentNode if the input wasn't already.
+func (p *Policy) CleanNode(root *html.Node) (*html.Node, error) {
+	return p.c.CleanNode(root)
+}
+
+// CleanString is a convenience wrapper for simple, string-in-string-out cleaning of markup
+func (p *Policy) CleanString(input string) (string, error) {
+	return p.c.CleanString(input)
+}
+
+// CleanWithReport behaves like Clean but also returns a report of everything removed
+func (p *Policy) CleanWithReport(input io.Reader) (*html.Node, *Report, error) {
+	return p.c.CleanWithReport(input)
+}
+
+// CleanFragment parses HTML input as the children of a context element rather than as a
+// full document, returning the sanitized nodes
+func (p *Policy) CleanFragment(input io.Reader, context atom.Atom) ([]*html.Node, error) {
+	return p.c.CleanFragment(input, context)
+}
+
+// CleanTo sanitizes HTML input as it is tokenized, writing the result to w. It fails with
+// html.ErrBufferExceeded on tokens larger than 1 MiB
+func (p *Policy) CleanTo(w io.Writer, input io.Reader) error {
+	return p.c.CleanTo(w, input)
+}
+
+// Validate checks HTML input against the policy's whitelist without modifying anything.
+// Transformers, post-transformers and finalizers are not run
+func (p *Policy) Validate(input io.Reader) error {
+	return p.c.Validate(input)
+}
+
+// Cleaner returns a new Cleaner initialized with a copy of the policy's rules, for
+// deriving variants of the policy
+func (p *Policy) Cleaner() Cleaner {
+	return p.c.clone()
+}
+
+// compiledRules holds the lookups a Policy precomputes from its rules, so that they
+// aren't derived again for every attribute cleaned
+type compiledRules struct {
+	globalAttrs attrRules
+	tags        map[*Tagdef]*tagRules
+}
+
+// tagRules holds the lookups precomputed from a single tagdef
+type tagRules struct {
+	attrs attrRules
+	// protocols holds the protocol rule of each attribute that has one
+	protocols map[string]*protocolRule
+	// urlAttrs holds the attributes with host or data URI rules
+	urlAttrs Attrset
+	// validatorPatterns holds the wildcard patterns among the validated attributes
+	validatorPatterns []string
+}
+
+// attrRules splits an Attrset into the attributes allowed by name and the patterns
+type attrRules struct {
+	names    Attrset
+	patterns []string
+}
+
+func newAttrRules(attrs Attrset) attrRules {
+	r := attrRules{names: make(Attrset)}
+	for attr := range attrs {
+		if strings.Contains(attr, "*") {
+			r.patterns = append(r.patterns, attr)
+		} else {
+			r.names[attr] = struct{}{}
+		}
+	}
+	return r
+}
+
+func (r attrRules) allows(key string) bool {
+	if _, ok := r.names[key]; ok {
+		return true
+	}
+	for _, pattern := range r.patterns {
+		if matchAttrPattern(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileRules precomputes the lookups for c's tagdefs, including those of document mode
+func compileRules(c *cleaner) *compiledRules {
+	rules := &compiledRules{globalAttrs: newAttrRules(c.globalAttrs), tags: make(map[*Tagdef]*tagRules)}
+	for _, tagdef := range c.w {
+		rules.tags[tagdef] = compileTagdef(c, tagdef)
+	}
+	for _, tagdef := range c.custom {
+		rules.tags[tagdef] = compileTagdef(c, tagdef)
+	}
+	if c.documentMode {
+		for _, tagdef := range documentWhitelist {
+			rules.tags[tagdef] = compileTagdef(c, tagdef)
+		}
+	}
+	return rules
+}
+
+// compileTagdef precomputes the lookups for a tagdef. c must not have rules yet, so that
+// they are derived from the cleaner's configuration
+func compileTagdef(c *cleaner, tagdef *Tagdef) *tagRules {
+	t := &tagRules{attrs: newAttrRules(tagdef.AllowedAttrs), protocols: make(map[string]*protocolRule), urlAttrs: make(Attrset)}
+	for attr := range urlAttrs {
+		t.protocols[attr] = c.protocolRule(tagdef, attr)
+	}
+	for attr := range tagdef.EnforcedProtocols {
+		t.protocols[attr] = c.protocolRule(tagdef, attr)
+	}
+	for attr := range tagdef.AllowedHosts {
+		t.urlAttrs[attr] = struct{}{}
+	}
+	for attr := range tagdef.DeniedHosts {
+		t.urlAttrs[attr] = struct{}{}
+	}
+	for attr := range tagdef.AllowedDataURIs {
+		t.urlAttrs[attr] = struct{}{}
+	}
+	for attr := range tagdef.ValidatedAttrs {
+		if strings.Contains(attr, "*") {
+			t.validatorPatterns = append(t.validatorPatterns, attr)
+		}
+	}
+	return t
+}
+
+// tag returns the precomputed lookups for tagdef, or nil if there are none
+func (r *compiledRules) tag(tagdef *Tagdef) *tagRules {
+	if r == nil {
+		return nil
+	}
+	return r.tags[tagdef]
+}
@@ -0,0 +1,154 @@
+package gsoup
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var _ Sanitizer = &Policy{}
+var _ Sanitizer = NewEmptyCleaner()
+
+func Test_Compile(t *testing.T) {
+	c := NewSimpleCleaner()
+	p := c.Compile()
+
+	// reconfiguring the cleaner must not affect the compiled policy
+	c.AddTags(T(atom.P)).RemoveTags(atom.B).PreserveChildren().Strict()
+	c.AddTransformer(func(x XNode) XNode { return nil })
+
+	actual, err := p.CleanString(`<b>bold</b><p>para</p>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<b>bold</b>`, actual)
+}
+
+func Test_Compile_DeepCopiesTagdefs(t *testing.T) {
+	def := T(atom.A, "href").EnforceProtocols("href", "http")
+	c := NewEmptyCleaner().AddTags(def)
+	p := c.Compile()
+
+	def.EnforceProtocols("href", "javascript")
+	def.AllowedAttrs["onclick"] = struct{}{}
+
+	actual, err := p.CleanString(`<a href="javascript:alert(1)" onclick="alert(1)">x</a>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<a>x</a>`, actual)
+}
+
+func Test_Policy_Methods(t *testing.T) {
+	p := NewBasicCleaner().Strict().Compile()
+
+	doc, err := p.Clean(strings.NewReader(`<p>x</p>`))
+	assert.Nil(t, err)
+	assert.NotNil(t, doc)
+
+	_, report, err := p.CleanWithReport(strings.NewReader(`<p onclick="x">x</p>`))
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(report.Removals))
+
+	assert.NotNil(t, p.Validate(strings.NewReader(`<div>x</div>`)))
+
+	nodes, err := p.CleanFragment(strings.NewReader(`<li>x</li>`), atom.Ul)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nodes))
+
+	doc, err = p.CleanNode(&html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P})
+	assert.Nil(t, err)
+	assert.Equal(t, html.DocumentNode, doc.Type)
+}
+
+func Test_Policy_Cleaner(t *testing.T) {
+	p := NewSimpleCleaner().Compile()
+	c := p.Cleaner().AddTags(T(atom.P))
+
+	actual, _ := c.CleanString(`<p>x</p>`)
+	assert.Equal(t, `<p>x</p>`, actual)
+	actual, _ = p.CleanString(`<p>x</p>`)
+	assert.Equal(t, ``, actual, "deriving a cleaner should not modify the policy")
+}
+
+func Test_Clone(t *testing.T) {
+	base := NewBasicCleaner()
+	variant := base.Clone().RemoveTags(atom.A).AddTags(T(atom.Div)).PreserveChildren()
+	variant.AddTransformer(func(x XNode) XNode {
+		if x.Atom() == atom.I {
+			x.SetAtom(atom.Em)
+		}
+		return x
+	})
+
+	assert.True(t, base.(*cleaner) != variant.(*cleaner))
+
+	actual, _ := base.CleanString(`<a href="http://x.com">a</a><div>d</div><i>i</i>`)
+	assert.Equal(t, `<a href="http://x.com" rel="nofollow">a</a><i>i</i>`, actual)
+	actual, _ = variant.CleanString(`<a href="http://x.com">a</a><div>d</div><i>i</i>`)
+	assert.Equal(t, `a<div>d</div><em>i</em>`, actual)
+
+	// tagdefs must be deep copied
+	variant.(*cleaner).w[atom.Q].AllowedAttrs["onclick"] = struct{}{}
+	_, ok := base.(*cleaner).w[atom.Q].AllowedAttrs["onclick"]
+	assert.False(t, ok)
+}
+
+func Test_Compile_PrecomputesRules(t *testing.T) {
+	def := T(atom.A, "href", "data-*", "title").ValidateAttr("data-*", MaxLength(3)).AllowHosts("href", "good.example")
+	c := NewEmptyCleaner().AddTags(def, T(atom.Img, "src"), TName("x-card", "title")).
+		AllowGlobalAttrs("aria-*").DefaultProtocols("https")
+	p := c.Compile()
+
+	rules := p.c.rules.tag(p.c.w[atom.A])
+	assert.NotNil(t, rules)
+	assert.Equal(t, []string{"data-*"}, rules.attrs.patterns)
+	assert.Equal(t, []string{"data-*"}, rules.validatorPatterns)
+	assert.Equal(t, Attrset{"href": struct{}{}}, rules.urlAttrs)
+	assert.Equal(t, Protoset{"https": struct{}{}}, rules.protocols["src"].protocols)
+	assert.Nil(t, rules.protocols["title"])
+	assert.NotNil(t, p.c.rules.tag(p.c.custom["x-card"]))
+	assert.Nil(t, c.(*cleaner).rules, "the source cleaner should not be compiled")
+
+	for _, input := range compiledInputs {
+		expected, err := c.CleanString(input)
+		assert.Nil(t, err, input)
+		actual, err := p.CleanString(input)
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, actual, input)
+	}
+}
+
+func Test_Policy_ConcurrentUse(t *testing.T) {
+	def := T(atom.A, "href", "data-*")
+	c := NewBasicCleaner().AddTags(def, TName("x-card", "title")).AllowGlobalAttrs("aria-*")
+	p := c.Compile()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				actual, err := p.CleanString(`<p onclick="x" aria-label="l">hi<a href="http://x.com" data-x="1" style="x">a</a><x-card title="t">c</x-card></p>`)
+				assert.Nil(t, err)
+				assert.Equal(t, `<p aria-label="l">hi<a href="http://x.com" data-x="1">a</a><x-card title="t">c</x-card></p>`, actual)
+			}
+		}()
+	}
+	// the source cleaner and its tagdefs remain mutable while the policy is in use
+	for j := 0; j < 50; j++ {
+		c.AddTags(T(atom.Div)).RemoveTags(atom.Div).AllowGlobalAttrs("id").DefaultProtocols("https")
+		def.EnforceProtocols("href", "javascript").AllowHosts("href", "evil.example")
+		def.AllowedAttrs["onclick"] = struct{}{}
+	}
+	wg.Wait()
+}
+
+var compiledInputs = []string{
+	`<a href="https://good.example/x" data-ok="abc" data-long="abcd" title="t" aria-label="l" onclick="x">a</a>`,
+	`<a href="https://evil.example/x" data-*="1">b</a>`,
+	`<a href="http://good.example/x">c</a><img src="https://good.example/i.png"><img src="http://x.example/i.png">`,
+	`<x-card title="t" data-x="1" aria-hidden="true">d</x-card><x-other>e</x-other><X-CARD>f</X-CARD>`,
+	`<img src="javascript:alert(1)" style="x" srcdoc="y" aria-src="z">`,
+}
@@ -0,0 +1,237 @@
+package gsoup
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// RemovalKind identifies the kind of markup removed during cleaning
+type RemovalKind int
+
+const (
+	// RemovedElement indicates an element (and possibly its children) was removed
+	RemovedElement RemovalKind = iota
+	// RemovedAttribute indicates an attribute was removed from an element
+	RemovedAttribute
+	// RemovedStyle indicates a declaration was removed from a style attribute
+	RemovedStyle
+	// RemovedComment indicates a comment was removed
+	RemovedComment
+	// RemovedDoctype indicates a doctype was removed
+	RemovedDoctype
+)
+
+var removalKindNames = map[RemovalKind]string{
+	RemovedElement:   "element",
+	RemovedAttribute: "attribute",
+	RemovedStyle:     "style",
+	RemovedComment:   "comment",
+	RemovedDoctype:   "doctype",
+}
+
+func (k RemovalKind) String() string {
+	return removalKindNames[k]
+}
+
+// Reason identifies why markup was removed during cleaning
+type Reason int
+
+const (
+	// ReasonNotAllowed indicates the markup is not permitted by the whitelist
+	ReasonNotAllowed Reason = iota
+	// ReasonAncestorRemoved indicates the markup was removed along with an ancestor element
+	ReasonAncestorRemoved
+	// ReasonInvalidURL indicates an attribute value could not be parsed as a URL
+	ReasonInvalidURL
+	// ReasonInvalidProtocol indicates a URL used a protocol not permitted for its attribute
+	ReasonInvalidProtocol
+	// ReasonRelativeLink indicates a relative URL was used where relative links are disallowed
+	ReasonRelativeLink
+	// ReasonInvalidValue indicates an attribute value failed validation
+	ReasonInvalidValue
+	// ReasonUnsafeStyle indicates a CSS declaration was not allowed or failed validation
+	ReasonUnsafeStyle
+	// ReasonHostNotAllowed indicates a URL's host was denied or not allowed
+	ReasonHostNotAllowed
+	// ReasonRewriterRejected indicates a URL was removed by the cleaner's URL rewriter
+	ReasonRewriterRejected
+	// ReasonConfusableHost indicates a URL's host mixes scripts or imitates another host
+	ReasonConfusableHost
+)
+
+var reasonNames = map[Reason]string{
+	ReasonNotAllowed:       "not allowed",
+	ReasonAncestorRemoved:  "ancestor removed",
+	ReasonInvalidURL:       "invalid URL",
+	ReasonInvalidProtocol:  "invalid protocol",
+	ReasonRelativeLink:     "relative link",
+	ReasonInvalidValue:     "invalid value",
+	ReasonUnsafeStyle:      "unsafe style",
+	ReasonHostNotAllowed:   "host not allowed",
+	ReasonRewriterRejected: "rejected by rewriter",
+	ReasonConfusableHost:   "confusable host",
+}
+
+func (r Reason) String() string {
+	return reasonNames[r]
+}
+
+// Removal describes a single piece of markup removed during cleaning
+type Removal struct {
+	Kind   RemovalKind
+	Reason Reason
+	// Name is the element name, attribute key or CSS property removed. Empty for comments
+	Name string
+	// Value is the original attribute value, CSS value, comment text or doctype
+	Value string
+	// Path is the slash-separated path of elements containing the removed markup,
+	// e.g. "html/body/div"
+	Path string
+}
+
+// Warning describes suspicious markup that was retained during cleaning
+type Warning struct {
+	Reason Reason
+	// Name is the attribute key
+	Name string
+	// Value is the attribute value, or the suspicious URL within it
+	Value string
+	// Path is the slash-separated path of the element with the attribute
+	Path string
+}
+
+// Report lists everything removed during a cleaning run, and any warnings about markup
+// that was retained. Nodes deleted by transformers are not reported
+type Report struct {
+	Removals []Removal
+	Warnings []Warning
+
+	// parents holds the path of each node's parent as it was before cleaning began,
+	// since elements are unwrapped and moved as the document is cleaned
+	parents map[*html.Node]string
+}
+
+// newReport creates a report for cleaning the tree rooted at root
+func newReport(root *html.Node) *Report {
+	r := &Report{parents: make(map[*html.Node]string)}
+	r.recordPaths(root, nodePath(root.Parent))
+	return r
+}
+
+func (r *Report) recordPaths(n *html.Node, parentPath string) {
+	r.parents[n] = parentPath
+	path := parentPath
+	if n.Type == html.ElementNode {
+		path = joinPath(parentPath, n.Data)
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		r.recordPaths(ch, path)
+	}
+}
+
+// parentPath returns the original path of the parent of n
+func (r *Report) parentPath(n *html.Node) string {
+	if path, ok := r.parents[n]; ok {
+		return path
+	}
+	return nodePath(n.Parent)
+}
+
+func (r *Report) add(removal Removal) {
+	if r != nil {
+		r.Removals = append(r.Removals, removal)
+	}
+}
+
+// warn records a warning about an attribute of n
+func (r *Report) warn(n *html.Node, warning Warning) {
+	if r != nil {
+		warning.Path = joinPath(r.parentPath(n), n.Data)
+		r.Warnings = append(r.Warnings, warning)
+	}
+}
+
+// removeNode records the removal of n and, if its children will not be preserved,
+// the elements and comments it contains
+func (r *Report) removeNode(n *html.Node, reason Reason, preserveChildren bool) {
+	if r == nil {
+		return
+	}
+	switch n.Type {
+	case html.CommentNode:
+		r.add(Removal{Kind: RemovedComment, Reason: reason, Value: n.Data, Path: r.parentPath(n)})
+	case html.DoctypeNode:
+		r.add(Removal{Kind: RemovedDoctype, Reason: reason, Value: n.Data, Path: r.parentPath(n)})
+	case html.ElementNode:
+		if !isScaffolding(n) {
+			r.add(Removal{Kind: RemovedElement, Reason: reason, Name: n.Data, Path: r.parentPath(n)})
+		}
+	}
+	if preserveChildren {
+		return
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		r.removeNode(ch, ReasonAncestorRemoved, false)
+	}
+}
+
+// removeAttr records the removal of an attribute from n
+func (r *Report) removeAttr(n *html.Node, attr html.Attribute, reason Reason) {
+	if r != nil {
+		r.add(Removal{Kind: RemovedAttribute, Reason: reason, Name: attr.Key, Value: attr.Val, Path: joinPath(r.parentPath(n), n.Data)})
+	}
+}
+
+// removeStyles records the removal of CSS declarations from the style attribute of n
+func (r *Report) removeStyles(n *html.Node, decls []cssDeclaration) {
+	if r == nil {
+		return
+	}
+	for _, decl := range decls {
+		r.add(Removal{Kind: RemovedStyle, Reason: ReasonUnsafeStyle, Name: decl.property, Value: decl.value, Path: joinPath(r.parentPath(n), n.Data)})
+	}
+}
+
+// isScaffolding reports whether n is document structure synthesized by the parser
+// rather than markup supplied by the user
+func isScaffolding(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Html, atom.Head, atom.Body:
+		return len(n.Attr) == 0
+	}
+	return false
+}
+
+// nodePath returns the slash-separated names of n and its element ancestors
+func nodePath(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	path := nodePath(n.Parent)
+	if n.Type == html.ElementNode {
+		path = joinPath(path, n.Data)
+	}
+	return path
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "/" + name
+}
+
+// protocolReason maps an error from enforceProtocol to a removal reason
+func protocolReason(err error) Reason {
+	switch err {
+	case errorInvalidProtocol:
+		return ReasonInvalidProtocol
+	case errorRelativeLink, errorSchemeRelative:
+		return ReasonRelativeLink
+	case errorHostNotAllowed:
+		return ReasonHostNotAllowed
+	case errorInvalidSrcset, errorInvalidDataURI:
+		return ReasonInvalidValue
+	}
+	return ReasonInvalidURL
+}
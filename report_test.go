@@ -0,0 +1,80 @@
+package gsoup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func Test_CleanWithReport(t *testing.T) {
+	c := NewBasicCleaner().AddTags(T(atom.P).AllowStyles("color"))
+
+	input := `<p onclick="alert(1)" style="color: red; position: fixed">hi<!-- sneaky --></p>` +
+		`<div><script>alert(1)</script></div>` +
+		`<a href="javascript:alert(1)">x</a><a href="/relative">y</a><a href=":">z</a>`
+	doc, report, err := c.CleanWithReport(strings.NewReader(input))
+	assert.Nil(t, err)
+	assert.NotNil(t, doc)
+	assert.Equal(t, []Removal{
+		{Kind: RemovedAttribute, Reason: ReasonNotAllowed, Name: "onclick", Value: "alert(1)", Path: "html/body/p"},
+		{Kind: RemovedStyle, Reason: ReasonUnsafeStyle, Name: "position", Value: "fixed", Path: "html/body/p"},
+		{Kind: RemovedComment, Reason: ReasonNotAllowed, Value: " sneaky ", Path: "html/body/p"},
+		{Kind: RemovedElement, Reason: ReasonNotAllowed, Name: "div", Path: "html/body"},
+		{Kind: RemovedElement, Reason: ReasonAncestorRemoved, Name: "script", Path: "html/body/div"},
+		{Kind: RemovedAttribute, Reason: ReasonInvalidProtocol, Name: "href", Value: "javascript:alert(1)", Path: "html/body/a"},
+		{Kind: RemovedAttribute, Reason: ReasonRelativeLink, Name: "href", Value: "/relative", Path: "html/body/a"},
+		{Kind: RemovedAttribute, Reason: ReasonInvalidURL, Name: "href", Value: ":", Path: "html/body/a"},
+	}, report.Removals)
+}
+
+func Test_CleanWithReport_PreserveChildren(t *testing.T) {
+	c := NewBasicCleaner().PreserveChildren()
+
+	_, report, err := c.CleanWithReport(strings.NewReader(`<div><p>hi</p><iframe><b>x</b></iframe></div>`))
+	assert.Nil(t, err)
+	assert.Equal(t, []Removal{
+		{Kind: RemovedElement, Reason: ReasonNotAllowed, Name: "div", Path: "html/body"},
+		{Kind: RemovedElement, Reason: ReasonNotAllowed, Name: "iframe", Path: "html/body/div"},
+	}, report.Removals)
+}
+
+func Test_CleanWithReport_Scaffolding(t *testing.T) {
+	_, report, err := NewBasicCleaner().CleanWithReport(strings.NewReader(`<p>hi</p>`))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(report.Removals), "parser-generated scaffolding should not be reported")
+
+	_, report, err = NewBasicCleaner().CleanWithReport(strings.NewReader(`<body onload="alert(1)"><p>hi</p></body>`))
+	assert.Nil(t, err)
+	assert.Equal(t, []Removal{{Kind: RemovedElement, Reason: ReasonNotAllowed, Name: "body", Path: "html"}}, report.Removals)
+}
+
+func Test_CleanWithReport_ParseError(t *testing.T) {
+	_, report, err := NewEmptyCleaner().CleanWithReport(badReader{})
+	assert.NotNil(t, err)
+	assert.Nil(t, report)
+}
+
+func Test_Report_nilSafe(t *testing.T) {
+	var r *Report
+	n := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+	r.add(Removal{})
+	r.removeNode(n, ReasonNotAllowed, false)
+	r.removeAttr(n, html.Attribute{Key: "id"}, ReasonNotAllowed)
+	r.removeStyles(n, []cssDeclaration{{property: "color"}})
+}
+
+func Test_nodePath(t *testing.T) {
+	doc, _ := html.Parse(strings.NewReader(`<div><p><b>x</b></p></div>`))
+	b := doc.LastChild.LastChild.FirstChild.FirstChild.FirstChild
+	assert.Equal(t, "html/body/div/p/b", nodePath(b))
+	assert.Equal(t, "", nodePath(doc))
+	assert.Equal(t, "", nodePath(nil))
+}
+
+func Test_RemovalKindAndReasonStrings(t *testing.T) {
+	assert.Equal(t, "attribute", RemovedAttribute.String())
+	assert.Equal(t, "invalid protocol", ReasonInvalidProtocol.String())
+}
@@ -0,0 +1,75 @@
+package gsoup
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// URLRewriter rewrites a URL found in the given attr of a tag once it has passed
+// validation. The returned value replaces the attribute's value without further checks,
+// so it must be a safe URL; returning "" removes the attribute. In a srcset, each
+// candidate URL is rewritten separately and the result must not contain whitespace
+type URLRewriter func(tag atom.Atom, attr string, u *url.URL) string
+
+// CamoRewriter returns a URLRewriter that routes absolute http and https image URLs, and
+// scheme-relative ones as https (img src and srcset), through a camo-compatible image proxy at proxy, e.g.
+// "https://camo.example.com". URLs are signed with an HMAC-SHA1 digest using key, and
+// the rewritten URL has the form <proxy>/<hex digest>/<hex encoded URL>
+func CamoRewriter(proxy string, key []byte) URLRewriter {
+	proxy = strings.TrimRight(proxy, "/")
+	proxyHost := ""
+	if p, err := url.Parse(proxy); err == nil {
+		proxyHost = p.Host
+	}
+	key = append([]byte(nil), key...)
+
+	return func(tag atom.Atom, attr string, u *url.URL) string {
+		if tag != atom.Img || attr != "src" && attr != "srcset" {
+			return u.String()
+		}
+		if u.Scheme == "" && u.Host != "" {
+			// scheme-relative URLs, kept by AllowSchemeRelative, are proxied as https
+			resolved := *u
+			resolved.Scheme = "https"
+			u = &resolved
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == proxyHost {
+			return u.String()
+		}
+		raw := u.String()
+		mac := hmac.New(sha1.New, key)
+		mac.Write([]byte(raw))
+		return proxy + "/" + hex.EncodeToString(mac.Sum(nil)) + "/" + hex.EncodeToString([]byte(raw))
+	}
+}
+
+// rewriteURL applies the cleaner's URL rewriter to a validated URL attribute value,
+// returning "" if the attribute should be removed
+func (c *cleaner) rewriteURL(n *html.Node, attrKey string, attrVal string) string {
+	if attrKey != "srcset" {
+		u, err := parseURL(attrVal)
+		if err != nil {
+			return ""
+		}
+		return c.rewriter(n.DataAtom, attrKey, u)
+	}
+
+	var kept []string
+	for _, candidate := range parseSrcset(attrVal) {
+		u, err := parseURL(candidate.url)
+		if err != nil {
+			continue
+		}
+		candidate.url = c.rewriter(n.DataAtom, attrKey, u)
+		if candidate.url != "" {
+			kept = append(kept, candidate.String())
+		}
+	}
+	return strings.Join(kept, ", ")
+}
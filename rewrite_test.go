@@ -0,0 +1,85 @@
+package gsoup
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html/atom"
+)
+
+const camoA = "https://camo.example/ecc8ab72d767428b6effbb61fe613f3100901b75/687474703a2f2f6578616d706c652e636f6d2f612e706e67"
+const camoB = "https://camo.example/d08eeb5c94c3aed0ba7df79a0bd1e39fc9c5543d/68747470733a2f2f6578616d706c652e636f6d2f622e706e67"
+
+func Test_CamoRewriter(t *testing.T) {
+	rewrite := CamoRewriter("https://camo.example/", []byte("secret"))
+
+	for raw, expected := range camoTests {
+		u, err := url.Parse(raw)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, rewrite(atom.Img, "src", u))
+	}
+
+	u, _ := url.Parse("http://example.com/a.png")
+	assert.Equal(t, camoA, rewrite(atom.Img, "srcset", u))
+	assert.Equal(t, "http://example.com/a.png", rewrite(atom.A, "href", u))
+	assert.Equal(t, "http://example.com/a.png", rewrite(atom.Img, "longdesc", u))
+
+	// scheme-relative URLs are proxied as https
+	https, _ := url.Parse("https://evil.example/x.png")
+	u, _ = url.Parse("//evil.example/x.png")
+	assert.Equal(t, rewrite(atom.Img, "src", https), rewrite(atom.Img, "src", u))
+	assert.Equal(t, rewrite(atom.Img, "srcset", https), rewrite(atom.Img, "srcset", u))
+	assert.True(t, strings.HasPrefix(rewrite(atom.Img, "src", u), "https://camo.example/"))
+	assert.Equal(t, "//evil.example/x.png", u.String(), "the URL passed in should not be modified")
+}
+
+func Test_Clean_RewriteURLs(t *testing.T) {
+	c := NewBasicCleanerWithImages().RewriteURLs(CamoRewriter("https://camo.example", []byte("secret")))
+
+	for input, expected := range rewriteTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+
+	// scheme-relative URLs must not bypass the proxy
+	rewrite := CamoRewriter("https://camo.example", []byte("secret"))
+	https, _ := url.Parse("https://evil.example/x.png")
+	camo := rewrite(atom.Img, "src", https)
+	c = NewBasicCleanerWithImages().AllowSchemeRelative().RewriteURLs(rewrite)
+	actual, err := c.CleanString(`<img src="//evil.example/x.png"><img srcset="//evil.example/x.png 2x">`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<img src="`+camo+`"/><img srcset="`+camo+` 2x"/>`, actual)
+
+	// the rewriter only sees URL attributes that passed validation, and may remove them
+	var seen []string
+	c = NewBasicCleanerWithImages().RewriteURLs(func(tag atom.Atom, attr string, u *url.URL) string {
+		seen = append(seen, tag.String()+" "+attr+" "+u.String())
+		if u.Host == "drop.example" {
+			return ""
+		}
+		return u.String()
+	})
+	_, report, err := c.CleanWithReport(strings.NewReader(`<a href="javascript:x">a</a><a href="https://drop.example/">b</a><img src="https://example.com/a.png" alt="x">`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a href https://drop.example/", "img src https://example.com/a.png"}, seen)
+	assert.Equal(t, 2, len(report.Removals))
+	assert.Equal(t, ReasonRewriterRejected, report.Removals[1].Reason)
+}
+
+var camoTests = map[string]string{
+	"http://example.com/a.png":          camoA,
+	"https://example.com/b.png":         camoB,
+	"/relative.png":                     "/relative.png",
+	"https://camo.example/x/y":          "https://camo.example/x/y",
+	"data:image/png;base64,iVBORw0KGgo": "data:image/png;base64,iVBORw0KGgo",
+}
+
+var rewriteTests = map[string]string{
+	`<img src="http://example.com/a.png">`:                                     `<img src="` + camoA + `"/>`,
+	`<img srcset="http://example.com/a.png 1x, https://example.com/b.png 2x">`: `<img srcset="` + camoA + ` 1x, ` + camoB + ` 2x"/>`,
+	`<a href="http://example.com/a.png">x</a>`:                                 `<a href="http://example.com/a.png" rel="nofollow">x</a>`,
+	`<img src="javascript:alert(1)">`:                                          `<img/>`,
+}
@@ -0,0 +1,295 @@
+package gsoup
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// selector is a compiled list of complex selectors, matching an element if any of them
+// matches it. The supported CSS subset is: type selectors, the universal selector *,
+// .class, #id, [attr], [attr=value], :first-child, the descendant and > combinators, and
+// comma-separated lists
+type selector []complexSelector
+
+// complexSelector is a chain of compound selectors. combinators[i] joins compounds[i]
+// and compounds[i+1], and is either ' ' (descendant) or '>' (child)
+type complexSelector struct {
+	compounds   []compoundSelector
+	combinators []byte
+}
+
+type compoundSelector struct {
+	tag        string
+	ids        []string
+	classes    []string
+	attrs      []attrSelector
+	firstChild bool
+}
+
+type attrSelector struct {
+	key    string
+	val    string
+	hasVal bool
+}
+
+// compileSelector parses a selector, returning an error if it is malformed or uses
+// unsupported syntax
+func compileSelector(s string) (selector, error) {
+	p := &selectorParser{s: s}
+	sel, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %v", s, err)
+	}
+	return sel, nil
+}
+
+func (sel selector) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, cs := range sel {
+		if cs.matches(n, len(cs.compounds)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether n matches the compound selector at index i and the
+// compound selectors before it match n's ancestors as required by the combinators
+func (cs complexSelector) matches(n *html.Node, i int) bool {
+	if !cs.compounds[i].matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	if cs.combinators[i-1] == '>' {
+		p := parentElement(n)
+		return p != nil && cs.matches(p, i-1)
+	}
+	for p := parentElement(n); p != nil; p = parentElement(p) {
+		if cs.matches(p, i-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c compoundSelector) matches(n *html.Node) bool {
+	if c.tag != "" && c.tag != "*" && strings.ToLower(n.Data) != c.tag {
+		return false
+	}
+	for _, id := range c.ids {
+		if val, ok := nodeAttr(n, "id"); !ok || val != id {
+			return false
+		}
+	}
+	if len(c.classes) > 0 {
+		val, _ := nodeAttr(n, "class")
+		classes := strings.FieldsFunc(val, func(r rune) bool { return r < 0x80 && isHTMLSpace(byte(r)) })
+		for _, class := range c.classes {
+			if !containsString(classes, class) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		val, ok := nodeAttr(n, a.key)
+		if !ok || (a.hasVal && val != a.val) {
+			return false
+		}
+	}
+	if c.firstChild {
+		for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+			if s.Type == html.ElementNode {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parentElement returns n's parent if it is an element, and nil otherwise
+func parentElement(n *html.Node) *html.Node {
+	if n.Parent != nil && n.Parent.Type == html.ElementNode {
+		return n.Parent
+	}
+	return nil
+}
+
+// nodeAttr returns the value of n's attribute with the given (lowercase) key
+func nodeAttr(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && strings.ToLower(attr.Key) == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type selectorParser struct {
+	s   string
+	pos int
+}
+
+func (p *selectorParser) parse() (selector, error) {
+	var sel selector
+	for {
+		p.skipSpace()
+		cs, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, cs)
+		if p.pos == len(p.s) {
+			return sel, nil
+		}
+		// parseComplex only stops early at a comma
+		p.pos++
+	}
+}
+
+func (p *selectorParser) parseComplex() (complexSelector, error) {
+	var cs complexSelector
+	for {
+		c, err := p.parseCompound()
+		if err != nil {
+			return cs, err
+		}
+		cs.compounds = append(cs.compounds, c)
+
+		space := p.skipSpace()
+		if p.pos == len(p.s) || p.s[p.pos] == ',' {
+			return cs, nil
+		}
+		if p.s[p.pos] == '>' {
+			p.pos++
+			p.skipSpace()
+			cs.combinators = append(cs.combinators, '>')
+		} else if space {
+			cs.combinators = append(cs.combinators, ' ')
+		} else {
+			return cs, fmt.Errorf("unexpected %q at offset %d", p.s[p.pos], p.pos)
+		}
+	}
+}
+
+func (p *selectorParser) parseCompound() (compoundSelector, error) {
+	var c compoundSelector
+	start := p.pos
+	if p.pos < len(p.s) && p.s[p.pos] == '*' {
+		p.pos++
+		c.tag = "*"
+	} else if name := p.ident(); name != "" {
+		c.tag = strings.ToLower(name)
+	}
+
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '.':
+			p.pos++
+			name := p.ident()
+			if name == "" {
+				return c, fmt.Errorf("expected class name at offset %d", p.pos)
+			}
+			c.classes = append(c.classes, name)
+		case '#':
+			p.pos++
+			name := p.ident()
+			if name == "" {
+				return c, fmt.Errorf("expected id at offset %d", p.pos)
+			}
+			c.ids = append(c.ids, name)
+		case '[':
+			p.pos++
+			a, err := p.parseAttr()
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, a)
+		case ':':
+			p.pos++
+			name := p.ident()
+			if strings.ToLower(name) != "first-child" {
+				return c, fmt.Errorf("unsupported pseudo-class %q", ":"+name)
+			}
+			c.firstChild = true
+		default:
+			if p.pos == start {
+				return c, fmt.Errorf("unexpected %q at offset %d", p.s[p.pos], p.pos)
+			}
+			return c, nil
+		}
+	}
+	if p.pos == start {
+		return c, fmt.Errorf("expected selector at offset %d", p.pos)
+	}
+	return c, nil
+}
+
+func (p *selectorParser) parseAttr() (attrSelector, error) {
+	var a attrSelector
+	p.skipSpace()
+	a.key = strings.ToLower(p.ident())
+	if a.key == "" {
+		return a, fmt.Errorf("expected attribute name at offset %d", p.pos)
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) && p.s[p.pos] == '=' {
+		p.pos++
+		p.skipSpace()
+		a.hasVal = true
+		if p.pos < len(p.s) && (p.s[p.pos] == '"' || p.s[p.pos] == '\'') {
+			quote := p.s[p.pos]
+			end := strings.IndexByte(p.s[p.pos+1:], quote)
+			if end < 0 {
+				return a, fmt.Errorf("unterminated string at offset %d", p.pos)
+			}
+			a.val = p.s[p.pos+1 : p.pos+1+end]
+			p.pos += end + 2
+		} else if a.val = p.ident(); a.val == "" {
+			return a, fmt.Errorf("expected attribute value at offset %d", p.pos)
+		}
+		p.skipSpace()
+	}
+	if p.pos == len(p.s) || p.s[p.pos] != ']' {
+		return a, fmt.Errorf("expected ] at offset %d", p.pos)
+	}
+	p.pos++
+	return a, nil
+}
+
+// ident consumes a run of characters valid in an unescaped CSS identifier
+func (p *selectorParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		ch := p.s[p.pos]
+		if ch == '-' || ch == '_' || ch >= 0x80 || (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') {
+			p.pos++
+		} else {
+			break
+		}
+	}
+	return p.s[start:p.pos]
+}
+
+// skipSpace consumes whitespace, reporting whether there was any
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.s) && isHTMLSpace(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.pos > start
+}
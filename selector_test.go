@@ -0,0 +1,141 @@
+package gsoup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const selectorDoc = `<div id="main" class="post  featured"><p class="lead">a</p><p data-x="1">b <b>c</b></p></div><section><p lang='en'>d</p>text<ul><li>e</li><li>f</li></ul></section>`
+
+func Test_Selector_matches(t *testing.T) {
+	doc, _ := html.Parse(strings.NewReader(selectorDoc))
+	for sel, expected := range selectorMatchTests {
+		s, err := compileSelector(sel)
+		assert.Nil(t, err, sel)
+		assert.Equal(t, expected, matchedText(doc, s), sel)
+	}
+}
+
+func Test_Selector_invalid(t *testing.T) {
+	for _, sel := range invalidSelectors {
+		_, err := compileSelector(sel)
+		assert.NotNil(t, err, sel)
+	}
+	assert.Panics(t, func() { NewEmptyCleaner().AddTransformerFor("p:hover", func(x XNode) XNode { return x }) })
+
+	c := NewEmptyCleaner().AddTags(T(atom.P))
+	_, err := c.TryAddTransformerFor("p:hover", func(x XNode) XNode { return nil })
+	assert.NotNil(t, err)
+	actual, _ := c.CleanString(`<p>a</p>`)
+	assert.Equal(t, `<p>a</p>`, actual, "the cleaner should be unchanged")
+	_, err = c.TryAddTransformerFor("p", func(x XNode) XNode { return nil })
+	assert.Nil(t, err)
+	actual, _ = c.CleanString(`<p>a</p>`)
+	assert.Equal(t, ``, actual)
+}
+
+func Test_AddTransformerFor(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.P, "class"), T(atom.Strong), T(atom.B), T(atom.Div))
+	c.AddTransformerFor("div > p:first-child, p.quote", func(x XNode) XNode {
+		x.SetAttr("class", "first")
+		return x
+	})
+	c.AddTransformerFor("p b", func(x XNode) XNode {
+		x.SetAtom(atom.Strong)
+		return x
+	})
+	actual, err := c.CleanString(`<div><p>1 <b>x</b></p><p class="quote">2</p><p>3</p></div><b>4</b>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<div><p class="first">1 <strong>x</strong></p><p class="first">2</p><p>3</p></div><b>4</b>`, actual)
+}
+
+func Test_AddTransformerFor_sanitizedAncestors(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.Div, "class"), T(atom.P), T(atom.B))
+	c.AddTransformerFor("p[onclick]", func(x XNode) XNode {
+		return nil
+	})
+	c.AddTransformerFor("div[onclick] p, div.x > p", func(x XNode) XNode {
+		x.SetAtom(atom.B)
+		return x
+	})
+	// the div's onclick is removed before its children are reached, while the second p is
+	// matched by its own onclick before it is removed
+	actual, err := c.CleanString(`<div onclick="a" class="x"><p>1</p><p onclick="b">2</p></div><div onclick="a"><p>3</p></div>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<div class="x"><b>1</b></div><div><p>3</p></div>`, actual)
+}
+
+// matchedText returns the text content of the elements matched by s, in document order
+func matchedText(n *html.Node, s selector) []string {
+	var result []string
+	if s.matches(n) {
+		result = append(result, textContent(n))
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		result = append(result, matchedText(ch, s)...)
+	}
+	return result
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var text string
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		text += textContent(ch)
+	}
+	return text
+}
+
+var selectorMatchTests = map[string][]string{
+	"p":                      {"a", "b c", "d"},
+	"P":                      {"a", "b c", "d"},
+	"li":                     {"e", "f"},
+	"section *":              {"d", "ef", "e", "f"},
+	".post":                  {"ab c"},
+	".featured.post":         {"ab c"},
+	".post.missing":          nil,
+	"#main":                  {"ab c"},
+	"div#main > .lead":       {"a"},
+	"[data-x]":               {"b c"},
+	"p[data-x=1]":            {"b c"},
+	"p[data-x='2']":          nil,
+	`[ lang = "en" ]`:        {"d"},
+	"div b":                  {"c"},
+	"div > b":                nil,
+	"body > div p > b":       {"c"},
+	"p:first-child":          {"a", "d"},
+	"li:first-child":         {"e"},
+	"section > :first-child": {"d"},
+	"b, li:first-child":      {"c", "e"},
+	"  ul  >  li ,  .lead  ": {"a", "e", "f"},
+	"blockquote":             nil,
+}
+
+var invalidSelectors = []string{
+	"",
+	" ",
+	"p,",
+	",p",
+	"p >",
+	"> p",
+	"p >> b",
+	"p + b",
+	"p ~ b",
+	".",
+	"#",
+	"p:hover",
+	"p::before",
+	"[",
+	"[]",
+	"[x",
+	"[x=]",
+	"[x='y]",
+	"[x^=y]",
+	"p:not(.a)",
+}
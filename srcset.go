@@ -0,0 +1,147 @@
+package gsoup
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// srcsetCandidate is a single image candidate from a srcset attribute
+type srcsetCandidate struct {
+	url         string
+	descriptors []string
+}
+
+func (c srcsetCandidate) String() string {
+	if len(c.descriptors) == 0 {
+		return c.url
+	}
+	return c.url + " " + strings.Join(c.descriptors, " ")
+}
+
+// parseSrcset splits a srcset attribute value into its image candidates, following the
+// HTML parsing rules: URLs are separated from their descriptors by whitespace and may
+// themselves contain commas (e.g. data URIs), while candidates are separated by commas
+func parseSrcset(srcset string) (candidates []srcsetCandidate) {
+	i := 0
+	for {
+		for i < len(srcset) && (isHTMLSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+		if i >= len(srcset) {
+			return candidates
+		}
+
+		start := i
+		for i < len(srcset) && !isHTMLSpace(srcset[i]) {
+			i++
+		}
+		candidate := srcsetCandidate{url: srcset[start:i]}
+
+		if strings.HasSuffix(candidate.url, ",") {
+			// a trailing comma ends the candidate, which has no descriptors
+			candidate.url = strings.TrimRight(candidate.url, ",")
+		} else {
+			start = i
+			depth := 0
+			for ; i < len(srcset); i++ {
+				if srcset[i] == '(' {
+					depth++
+				} else if srcset[i] == ')' && depth > 0 {
+					depth--
+				} else if srcset[i] == ',' && depth == 0 {
+					break
+				}
+			}
+			candidate.descriptors = strings.Fields(srcset[start:i])
+		}
+		candidates = append(candidates, candidate)
+	}
+}
+
+// validSrcsetDescriptors reports whether a candidate's descriptors are valid: at most one
+// width (w) or pixel density (x) descriptor, and a height (h) descriptor only with a width
+func validSrcsetDescriptors(descriptors []string) bool {
+	var width, height, density bool
+	for _, d := range descriptors {
+		if len(d) < 2 {
+			return false
+		}
+		value := d[:len(d)-1]
+		switch d[len(d)-1] {
+		case 'w':
+			if width || density || !positiveInteger(value) {
+				return false
+			}
+			width = true
+		case 'h':
+			if height || density || !positiveInteger(value) {
+				return false
+			}
+			height = true
+		case 'x':
+			if width || height || density || !positiveFloat(value) {
+				return false
+			}
+			density = true
+		default:
+			return false
+		}
+	}
+	return width || !height
+}
+
+var positiveIntegerPattern = regexp.MustCompile(`^[0-9]+$`)
+var positiveFloatPattern = regexp.MustCompile(`^(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)(?:[eE][+-]?[0-9]+)?$`)
+
+func positiveInteger(s string) bool {
+	if !positiveIntegerPattern.MatchString(s) {
+		return false
+	}
+	i, err := strconv.Atoi(s)
+	return err == nil && i > 0
+}
+
+func positiveFloat(s string) bool {
+	if !positiveFloatPattern.MatchString(s) {
+		return false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return err == nil && f > 0
+}
+
+func isHTMLSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\f' || ch == '\r'
+}
+
+// enforceSrcset applies the protocol and host rules to each candidate URL in a srcset
+// value. Candidates with invalid URLs or descriptors are dropped, and the remainder are
+// re-serialized. If no candidates remain, an error is returned
+func (c *cleaner) enforceSrcset(tagdef *Tagdef, attrKey string, attrVal string, rule *protocolRule) (string, error) {
+	var kept []string
+	err := errorInvalidSrcset
+	for _, candidate := range parseSrcset(attrVal) {
+		if !validSrcsetDescriptors(candidate.descriptors) {
+			continue
+		}
+		u, urlErr := c.checkURL(tagdef, attrKey, candidate.url, rule)
+		if urlErr != nil {
+			err = urlErr
+			continue
+		}
+		candidate.url = u.String()
+		kept = append(kept, candidate.String())
+	}
+	if len(kept) == 0 {
+		return "", err
+	}
+	return strings.Join(kept, ", "), nil
+}
+
+var sizesMediaFeature = `\(\s*(?:(?:min|max)-)?(?:width|height)\s*:\s*` + cssLength + `\s*\)`
+var sizesMediaCondition = `(?:not\s+)?` + sizesMediaFeature + `(?:\s+(?:and|or)\s+` + sizesMediaFeature + `)*`
+var sizesSourceSize = `(?:` + sizesMediaCondition + `\s+)?(?:` + cssLength + `|calc\([-+*/ 0-9.a-z%]+\))`
+
+// sizesPattern matches the value of a sizes attribute: a comma-separated list of lengths,
+// each optionally preceded by a media condition on the viewport's width or height
+var sizesPattern = regexp.MustCompile(`(?i)\s*` + sizesSourceSize + `(?:\s*,\s*` + sizesSourceSize + `)*\s*`)
@@ -0,0 +1,113 @@
+package gsoup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html/atom"
+)
+
+func Test_parseSrcset(t *testing.T) {
+	for input, expected := range srcsetParseTests {
+		actual := parseSrcset(input)
+		assert.True(t, reflect.DeepEqual(expected, actual), "parseSrcset(%q) = %v", input, actual)
+	}
+}
+
+func Test_validSrcsetDescriptors(t *testing.T) {
+	for descriptors, expected := range srcsetDescriptorTests {
+		assert.Equal(t, expected, validSrcsetDescriptors(parseSrcset("a.png " + descriptors)[0].descriptors), descriptors)
+	}
+}
+
+func Test_sizesPattern(t *testing.T) {
+	v := MatchRegexp(sizesPattern)
+	for sizes, expected := range sizesTests {
+		assert.Equal(t, expected, v.Validate(sizes), sizes)
+	}
+}
+
+func Test_enforceSrcset(t *testing.T) {
+	c := NewEmptyCleaner().DenyHosts("tracker.example").(*cleaner)
+	tdef := T(atom.Img, "srcset").EnforceProtocols("srcset", "http", "https")
+
+	_, err := c.enforceProtocol(tdef, "srcset", "a.png 1x")
+	assert.Equal(t, errorRelativeLink, err)
+	_, err = c.enforceProtocol(tdef, "srcset", " , ")
+	assert.Equal(t, errorInvalidSrcset, err)
+	_, err = c.enforceProtocol(tdef, "srcset", "http://a.example/a.png 1y")
+	assert.Equal(t, errorInvalidSrcset, err)
+
+	tdef.AllowRelativeLinks()
+	result, err := c.enforceProtocol(tdef, "srcset", "a.png 1x,javascript:alert(1) 2x,  HTTPS://cdn.example/b.png   2x , http://tracker.example/c.png 3x, d.png 4q")
+	assert.Nil(t, err)
+	assert.Equal(t, "a.png 1x, https://cdn.example/b.png 2x", result)
+}
+
+func Test_Clean_ResponsiveImages(t *testing.T) {
+	c := NewBasicCleanerWithImages()
+
+	for input, expected := range responsiveImageTests {
+		actual, err := c.CleanString(input)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+var srcsetParseTests = map[string][]srcsetCandidate{
+	"":                nil,
+	" , ,":            nil,
+	"a.png":           {{url: "a.png", descriptors: []string{}}},
+	"a.png, b.png 2x": {{url: "a.png"}, {url: "b.png", descriptors: []string{"2x"}}},
+	"a.png 100w 50h":  {{url: "a.png", descriptors: []string{"100w", "50h"}}},
+	"a.png 1x,b.png":  {{url: "a.png", descriptors: []string{"1x"}}, {url: "b.png", descriptors: []string{}}},
+	"a.png,,, b.png":  {{url: "a.png"}, {url: "b.png", descriptors: []string{}}},
+	"data:image/png;base64,AAA= 1x, b.png 2x": {
+		{url: "data:image/png;base64,AAA=", descriptors: []string{"1x"}},
+		{url: "b.png", descriptors: []string{"2x"}},
+	},
+	"a.png foo(1, 2) 1x": {{url: "a.png", descriptors: []string{"foo(1,", "2)", "1x"}}},
+}
+
+var srcsetDescriptorTests = map[string]bool{
+	"":          true,
+	"1x":        true,
+	"1.5x":      true,
+	".5x":       true,
+	"2e1x":      true,
+	"100w":      true,
+	"100w 50h":  true,
+	"50h 100w":  true,
+	"0x":        false,
+	"-1x":       false,
+	"0w":        false,
+	"1.5w":      false,
+	"50h":       false,
+	"1x 2x":     false,
+	"100w 1x":   false,
+	"100w 200w": false,
+	"1X":        false,
+	"x":         false,
+	"1y":        false,
+}
+
+var sizesTests = map[string]bool{
+	"100vw":                          true,
+	"(max-width: 600px) 100vw, 50vw": true,
+	"(min-width:40em) and (max-height: 90vh) 480px, calc(100vw - 2rem)": true,
+	"not (max-width: 600px) 50%":                                        true,
+	"auto":                                                              true,
+	"":                                                                  false,
+	"url(x)":                                                            false,
+	"(max-width: 600px)":                                                false,
+	"(orientation: portrait) 100vw":                                     false,
+	"100vw, expression(alert(1))":                                       false,
+	"calc(100vw - var(--gutter))":                                       false,
+}
+
+var responsiveImageTests = map[string]string{
+	`<img src="https://a.example/a.png" srcset="https://a.example/a.png 1x, https://a.example/b.png 2x">`:           `<img src="https://a.example/a.png" srcset="https://a.example/a.png 1x, https://a.example/b.png 2x"/>`,
+	`<img srcset="https://a.example/a.png 480w, javascript:alert(1) 800w" sizes="(max-width: 600px) 480px, 800px">`: `<img srcset="https://a.example/a.png 480w" sizes="(max-width: 600px) 480px, 800px"/>`,
+	`<img srcset="javascript:alert(1) 1x" sizes="url(x)" alt="x">`:                                                  `<img alt="x"/>`,
+}
@@ -0,0 +1,240 @@
+package gsoup
+
+import (
+	"bufio"
+	"io"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxStreamTokenSize bounds the memory used to buffer any single token while streaming.
+// Larger tokens cause CleanTo to fail with html.ErrBufferExceeded
+const maxStreamTokenSize = 1 << 20
+
+// maxStreamDepth bounds the element stack while streaming. Elements nested more deeply
+// are removed, though their children are retained unless an ancestor is being deleted
+const maxStreamDepth = 512
+
+// voidElements can have no children, and so are never pushed on the stream's element stack
+var voidElements = Tagset{
+	atom.Area:   struct{}{},
+	atom.Base:   struct{}{},
+	atom.Br:     struct{}{},
+	atom.Col:    struct{}{},
+	atom.Embed:  struct{}{},
+	atom.Hr:     struct{}{},
+	atom.Img:    struct{}{},
+	atom.Input:  struct{}{},
+	atom.Keygen: struct{}{},
+	atom.Link:   struct{}{},
+	atom.Meta:   struct{}{},
+	atom.Param:  struct{}{},
+	atom.Source: struct{}{},
+	atom.Track:  struct{}{},
+	atom.Wbr:    struct{}{},
+}
+
+// rawTextElements have text content that is written without escaping
+var rawTextElements = Tagset{
+	atom.Iframe:    struct{}{},
+	atom.Noembed:   struct{}{},
+	atom.Noframes:  struct{}{},
+	atom.Noscript:  struct{}{},
+	atom.Plaintext: struct{}{},
+	atom.Script:    struct{}{},
+	atom.Style:     struct{}{},
+	atom.Xmp:       struct{}{},
+}
+
+// streamElement is an entry in the stack of open elements maintained while streaming
+type streamElement struct {
+	// node holds the element's name and cleaned attributes. It is linked to its parent
+	// but has no children, so that report paths can be computed
+	node *html.Node
+	// emitted is true if the element's start tag was written
+	emitted bool
+	// deleting is true if the element's children are being deleted with it
+	deleting bool
+}
+
+// streamer holds the state of a single CleanTo call
+type streamer struct {
+	c        *cleaner
+	w        *bufio.Writer
+	stack    []streamElement
+	deleting int
+	report   *Report
+}
+
+// CleanTo sanitizes HTML input using the same whitelist rules as Clean, but writes the
+// result to w as the input is tokenized rather than building a DOM, so memory use is
+// bounded regardless of input size. To keep it bounded, any single token larger than
+// 1 MiB, such as a long run of text or a tag with a large data: URI, makes CleanTo fail
+// with html.ErrBufferExceeded, even though Clean accepts the same input. Transformers
+// are not applied. In strict mode, CleanTo stops at the first violation and returns a
+// *ValidationError; anything already written to w should be discarded. Its paths only
+// list the elements present in the input, e.g. "p/a" where Clean, which adds the
+// implied html and body elements, reports "html/body/p/a"
+func (c *cleaner) CleanTo(w io.Writer, input io.Reader) error {
+	s := &streamer{c: c, w: bufio.NewWriter(w)}
+	if c.strict {
+		s.report = &Report{}
+	}
+
+	z := html.NewTokenizer(input)
+	z.SetMaxBuf(maxStreamTokenSize)
+	for {
+		if z.Next() == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return z.Err()
+			}
+			s.closeAll()
+			return s.w.Flush()
+		}
+
+		s.token(z.Token())
+
+		if s.report != nil && len(s.report.Removals) > 0 {
+			s.w.Flush()
+			return s.report.violations()
+		}
+	}
+}
+
+func (s *streamer) token(tok html.Token) {
+	switch tok.Type {
+	case html.TextToken:
+		if s.deleting > 0 {
+			return
+		}
+		// raw text is only written verbatim inside a raw text element that was itself written.
+		// Anything else, e.g. the contents of a removed <xmp>, must be escaped
+		if top := s.top(); top != nil && top.emitted && isRawText(top.node) {
+			s.w.WriteString(tok.Data)
+		} else {
+			s.w.WriteString(tok.String())
+		}
+
+	case html.StartTagToken, html.SelfClosingTagToken:
+		s.startTag(tok)
+
+	case html.EndTagToken:
+		s.endTag(tok)
+
+	case html.DoctypeToken:
+		if s.c.documentMode {
+			s.w.WriteString("<!DOCTYPE html>")
+		} else if s.deleting == 0 {
+			s.report.add(Removal{Kind: RemovedDoctype, Reason: ReasonNotAllowed, Value: tok.Data, Path: s.path()})
+		}
+
+	case html.CommentToken:
+		if s.deleting == 0 {
+			s.report.add(Removal{Kind: RemovedComment, Reason: ReasonNotAllowed, Value: tok.Data, Path: s.path()})
+		}
+	}
+}
+
+func (s *streamer) startTag(tok html.Token) {
+	n := &html.Node{Type: html.ElementNode, DataAtom: tok.DataAtom, Data: tok.Data, Attr: tok.Attr}
+	if top := s.top(); top != nil {
+		n.Parent = top.node
+	}
+	_, void := voidElements[n.DataAtom]
+
+	if len(s.stack) >= maxStreamDepth {
+		if s.deleting == 0 {
+			s.report.removeNode(n, ReasonNotAllowed, true)
+		}
+		return
+	}
+
+	if s.deleting > 0 {
+		if !void {
+			s.push(streamElement{node: n})
+		}
+		return
+	}
+
+	tagdef, ok := s.c.lookup(n)
+	if !ok {
+		preserve := s.c.shouldPreserveChildren(n)
+		s.report.removeNode(n, ReasonNotAllowed, true)
+		if !void {
+			s.push(streamElement{node: n, deleting: !preserve})
+		}
+		return
+	}
+
+	if !s.c.stripInvalidAttributes(n, tagdef, s.report, nil) {
+		preserve := s.c.shouldPreserveChildren(n)
+		s.report.removeNode(n, ReasonHostNotAllowed, true)
+		if !void {
+			s.push(streamElement{node: n, deleting: !preserve})
+		}
+		return
+	}
+	if void {
+		s.w.WriteString(html.Token{Type: html.SelfClosingTagToken, DataAtom: n.DataAtom, Data: n.Data, Attr: n.Attr}.String())
+		return
+	}
+	// a trailing slash has no effect on non-void elements, so they are always opened
+	s.w.WriteString(html.Token{Type: html.StartTagToken, DataAtom: n.DataAtom, Data: n.Data, Attr: n.Attr}.String())
+	s.push(streamElement{node: n, emitted: true})
+}
+
+func (s *streamer) endTag(tok html.Token) {
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		if s.stack[i].node.Data == tok.Data {
+			s.popTo(i)
+			return
+		}
+	}
+	// end tags without a matching open element are dropped
+}
+
+func (s *streamer) push(e streamElement) {
+	if e.deleting {
+		s.deleting++
+	}
+	s.stack = append(s.stack, e)
+}
+
+// popTo closes all open elements from the top of the stack down to index i
+func (s *streamer) popTo(i int) {
+	for j := len(s.stack) - 1; j >= i; j-- {
+		e := s.stack[j]
+		if e.emitted {
+			s.w.WriteString(html.Token{Type: html.EndTagToken, DataAtom: e.node.DataAtom, Data: e.node.Data}.String())
+		}
+		if e.deleting {
+			s.deleting--
+		}
+	}
+	s.stack = s.stack[:i]
+}
+
+func (s *streamer) closeAll() {
+	s.popTo(0)
+}
+
+func (s *streamer) top() *streamElement {
+	if len(s.stack) == 0 {
+		return nil
+	}
+	return &s.stack[len(s.stack)-1]
+}
+
+// path returns the path of the innermost open element
+func (s *streamer) path() string {
+	if top := s.top(); top != nil {
+		return nodePath(top.node)
+	}
+	return ""
+}
+
+func isRawText(n *html.Node) bool {
+	_, ok := rawTextElements[n.DataAtom]
+	return ok
+}
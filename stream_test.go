@@ -0,0 +1,139 @@
+package gsoup
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func Test_CleanTo(t *testing.T) {
+	c := NewBasicCleaner().(*cleaner)
+
+	for input, expected := range streamKillChildren {
+		var buf bytes.Buffer
+		err := c.CleanTo(&buf, strings.NewReader(input))
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, buf.String())
+	}
+
+	c.preserveChildren = true
+	for input, expected := range streamPreserveChildren {
+		var buf bytes.Buffer
+		err := c.CleanTo(&buf, strings.NewReader(input))
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, buf.String())
+	}
+}
+
+func Test_CleanTo_MatchesClean(t *testing.T) {
+	c := NewBasicCleaner().PreserveChildren()
+
+	for input := range basicWhitelistpreserveChildren {
+		var buf bytes.Buffer
+		err := c.CleanTo(&buf, strings.NewReader(input))
+		assert.Nil(t, err)
+		expected, err := c.CleanString(input)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, buf.String(), "streamed output should match DOM output for %s", input)
+	}
+}
+
+func Test_CleanTo_RawText(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.Xmp)).PreserveChildren()
+
+	var buf bytes.Buffer
+	err := c.CleanTo(&buf, strings.NewReader(`<xmp><b>&amp;</b></xmp>`))
+	assert.Nil(t, err)
+	assert.Equal(t, `<xmp><b>&amp;</b></xmp>`, buf.String(), "text of allowed raw text elements is written verbatim")
+
+	c.RemoveTags(atom.Xmp)
+	buf.Reset()
+	err = c.CleanTo(&buf, strings.NewReader(`<xmp><script>alert(1)</script></xmp>`))
+	assert.Nil(t, err)
+	assert.Equal(t, `&lt;script&gt;alert(1)&lt;/script&gt;`, buf.String(), "text of removed raw text elements must be escaped")
+}
+
+func Test_CleanTo_DeepNesting(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.B))
+
+	input := strings.Repeat("<b>", maxStreamDepth+10) + "x"
+	var buf bytes.Buffer
+	err := c.CleanTo(&buf, strings.NewReader(input))
+	assert.Nil(t, err)
+	expected := strings.Repeat("<b>", maxStreamDepth) + "x" + strings.Repeat("</b>", maxStreamDepth)
+	assert.Equal(t, expected, buf.String())
+}
+
+func Test_CleanTo_Errors(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewBasicCleaner().CleanTo(&buf, badReader{})
+	assert.NotNil(t, err)
+
+	err = NewBasicCleaner().CleanTo(&buf, strings.NewReader("<p>"+strings.Repeat("x", maxStreamTokenSize+1)))
+	assert.Equal(t, html.ErrBufferExceeded, err)
+}
+
+func Test_CleanTo_Strict(t *testing.T) {
+	c := NewBasicCleaner().Strict()
+
+	var buf bytes.Buffer
+	err := c.CleanTo(&buf, strings.NewReader(`<p>ok</p>`))
+	assert.Nil(t, err)
+	assert.Equal(t, `<p>ok</p>`, buf.String())
+
+	for input, expected := range streamStrictTests {
+		buf.Reset()
+		err = c.CleanTo(&buf, strings.NewReader(input))
+		assert.IsType(t, &ValidationError{}, err)
+		assert.Equal(t, expected, err.Error())
+	}
+
+	// paths only list the elements present in the input
+	input := `<p><a onclick="x">y</a></p>`
+	err = c.CleanTo(&buf, strings.NewReader(input))
+	assert.Equal(t, "p/a", err.(*ValidationError).Violations[0].Path)
+	_, err = c.CleanString(input)
+	assert.Equal(t, "html/body/p/a", err.(*ValidationError).Violations[0].Path)
+}
+
+func Test_CleanTo_DocumentMode(t *testing.T) {
+	c := NewBasicCleaner().DocumentMode()
+
+	var buf bytes.Buffer
+	err := c.CleanTo(&buf, strings.NewReader(`<!DOCTYPE html><html lang="en"><head><title>t</title><script>x</script></head><body><p>hi</p></body></html>`))
+	assert.Nil(t, err)
+	assert.Equal(t, `<!DOCTYPE html><html lang="en"><head><title>t</title></head><body><p>hi</p></body></html>`, buf.String())
+}
+
+var streamKillChildren = map[string]string{
+	`plain text`:                            `plain text`,
+	`plain text<!-- comment -->`:            `plain text`,
+	`<p>plain text</p><div>more text</div>`: `<p>plain text</p>`,
+	`<p>unclosed <b>tags`:                   `<p>unclosed <b>tags</b></p>`,
+	`<p>stray</b> end</p></p>`:              `<p>stray end</p>`,
+	`<div><p>nested</p></div><p>after</p>`:  `<p>after</p>`,
+	`<p/>self closing`:                      `<p>self closing</p>`,
+	`a<br>b<br/>c`:                          `a<br/>b<br/>c`,
+}
+
+var streamPreserveChildren = map[string]string{
+	`<div><p>nested</p></div>`:                        `<p>nested</p>`,
+	`<p><script>alert(1)</script>x</p>`:               `<p>x</p>`,
+	`<p><style><b>x</b></style>y</p>`:                 `<p>y</p>`,
+	`<a href="javascript:alert(1)" onclick="x">a</a>`: `<a rel="nofollow">a</a>`,
+	`<html><body><p>x</p></body></html>`:              `<p>x</p>`,
+	`<head><title>t</title></head><p>x</p>`:           `<p>x</p>`,
+	`<p>a &lt; b &amp; c</p>`:                         `<p>a &lt; b &amp; c</p>`,
+}
+
+var streamStrictTests = map[string]string{
+	`<p onclick="x">a</p>`:        `gsoup: 1 violation: attribute onclick="x" on p: not allowed`,
+	`<p>a<div>b</div></p>`:        `gsoup: 1 violation: element <div> in p: not allowed`,
+	`<p><!-- hi --></p>`:          `gsoup: 1 violation: comment in p: not allowed`,
+	`<!DOCTYPE html><p>a</p>`:     `gsoup: 1 violation: doctype: not allowed`,
+	`<p><a href="/rel">x</a></p>`: `gsoup: 1 violation: attribute href="/rel" on p/a: relative link`,
+}
@@ -1,47 +1,185 @@
 package gsoup
 
 import (
+	"fmt"
+	"strings"
+
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 )
 
-// XNode is a wrapper around an *html.Node to enforce safe transformations
+// XNode is a wrapper around an *html.Node to enforce safe transformations. Navigation
+// never leaves the document: the document node itself is not exposed. Tree edits that
+// would make a node its own ancestor are ignored
 type XNode interface {
 	FirstChild() XNode
 	LastChild() XNode
+	// Parent returns the node's parent element, or nil at the top of the document
+	Parent() XNode
+	NextSibling() XNode
+	PrevSibling() XNode
 	Type() html.NodeType
 	Atom() atom.Atom
 	Data() string
 	Attr() []html.Attribute
+	// SetType changes the node's type. Raw and document nodes cannot be created
 	SetType(html.NodeType)
 	SetAtom(atom.Atom)
 	SetData(string)
 	SetAttrs([]html.Attribute)
+
+	// GetAttr returns the value of the attribute with the given key, if present
+	GetAttr(key string) (string, bool)
+	// SetAttr sets the value of an attribute, adding it if necessary
+	SetAttr(key string, value string)
+	// RemoveAttr removes an attribute
+	RemoveAttr(key string)
+
+	// AppendChild adds a node as the last child of the receiver, moving it if it is
+	// already in the tree
+	AppendChild(child XNode)
+	// InsertBefore inserts a node immediately before the receiver
+	InsertBefore(sibling XNode)
+	// InsertAfter inserts a node immediately after the receiver
+	InsertAfter(sibling XNode)
+	// ReplaceWith puts a node in the receiver's place, removing the receiver
+	ReplaceWith(replacement XNode)
+	// Wrap puts an element in the receiver's place, moving the receiver into it as its
+	// last child
+	Wrap(wrapper XNode)
+	// Unwrap replaces the receiver with its children
+	Unwrap()
+	// Remove removes the receiver and its children from the tree
+	Remove()
 }
 
-// TransformFunc describes the signature of a transform function
+// TransformFunc describes the signature of a transform function. Transformers are applied
+// once to each element and text node of the input in document order, just before it is
+// checked against the whitelist, so the nodes preceding it have already been sanitized.
+// The content of elements removed with their children is not transformed. Nodes created
+// with NewElement or NewText are checked but not transformed
 type TransformFunc func(XNode) XNode
 
-func newXNode(n *html.Node) XNode {
-	return &tnode{node: n}
+// FinalizerFunc describes the signature of a finalizer, which is called with the document
+// node once it has been sanitized. The document node itself cannot be modified, but nodes
+// can be appended to it and its descendants can be
+type FinalizerFunc func(XNode)
+
+// TransformErrFunc is like TransformFunc, but may return an error to abort cleaning. The
+// error is returned from the Clean methods wrapped in a *TransformError
+type TransformErrFunc func(XNode) (XNode, error)
+
+// FinalizerErrFunc is like FinalizerFunc, but may return an error to abort cleaning. The
+// error is returned from the Clean methods wrapped in a *TransformError
+type FinalizerErrFunc func(XNode) error
+
+// TransformPhase identifies a phase of cleaning in which transformers are applied
+type TransformPhase int
+
+const (
+	// PhaseTransform is the phase of transformers applied before sanitization
+	PhaseTransform TransformPhase = iota
+	// PhasePostTransform is the phase of transformers applied after sanitization
+	PhasePostTransform
+	// PhaseFinalize is the phase of finalizers
+	PhaseFinalize
+)
+
+var transformPhaseNames = map[TransformPhase]string{
+	PhaseTransform:     "transformer",
+	PhasePostTransform: "post-transformer",
+	PhaseFinalize:      "finalizer",
+}
+
+func (p TransformPhase) String() string {
+	return transformPhaseNames[p]
+}
+
+// TransformError is returned when a transformer or finalizer aborts cleaning
+type TransformError struct {
+	Phase TransformPhase
+	// Index is the position of the transformer among those of its phase, in the order
+	// they were added
+	Index int
+	// Node is the node the transformer was applied to, or the document node for finalizers
+	Node *html.Node
+	// Err is the error returned by the transformer
+	Err error
+}
+
+func (e *TransformError) Error() string {
+	var desc string
+	switch e.Node.Type {
+	case html.ElementNode:
+		desc = "element <" + e.Node.Data + ">"
+		if path := nodePath(e.Node.Parent); path != "" {
+			desc += " in " + path
+		}
+	case html.TextNode:
+		desc = "text in " + nodePath(e.Node.Parent)
+	default:
+		desc = "document"
+	}
+	return fmt.Sprintf("gsoup: %s %d failed on %s: %v", e.Phase, e.Index, desc, e.Err)
+}
+
+// Unwrap returns the error returned by the transformer
+func (e *TransformError) Unwrap() error {
+	return e.Err
+}
+
+// errFunc adapts a TransformFunc to a TransformErrFunc
+func (f TransformFunc) errFunc() TransformErrFunc {
+	return func(x XNode) (XNode, error) {
+		return f(x), nil
+	}
+}
+
+// NewElement creates an element for insertion into the tree by a transformer
+func NewElement(tag atom.Atom, attrs ...html.Attribute) XNode {
+	return newXNode(&html.Node{Type: html.ElementNode, DataAtom: tag, Data: tag.String(), Attr: attrs}, nil)
+}
+
+// NewText creates a text node for insertion into the tree by a transformer
+func NewText(text string) XNode {
+	return newXNode(&html.Node{Type: html.TextNode, Data: text}, nil)
+}
+
+func newXNode(n *html.Node, p *cleanPass) XNode {
+	if n == nil {
+		return nil
+	}
+	return &tnode{node: n, pass: p}
 }
 
 type tnode struct {
 	node *html.Node
+	// pass is the cleaning pass the node was reached from, if any, which is told of
+	// changes to the structure of the tree
+	pass *cleanPass
 }
 
 func (t *tnode) FirstChild() XNode {
-	if t.node.FirstChild != nil {
-		return newXNode(t.node.FirstChild)
-	}
-	return nil
+	return newXNode(t.node.FirstChild, t.pass)
 }
 
 func (t *tnode) LastChild() XNode {
-	if t.node.LastChild != nil {
-		return newXNode(t.node.LastChild)
+	return newXNode(t.node.LastChild, t.pass)
+}
+
+func (t *tnode) Parent() XNode {
+	if t.node.Parent == nil || t.node.Parent.Type == html.DocumentNode {
+		return nil
 	}
-	return nil
+	return newXNode(t.node.Parent, t.pass)
+}
+
+func (t *tnode) NextSibling() XNode {
+	return newXNode(t.node.NextSibling, t.pass)
+}
+
+func (t *tnode) PrevSibling() XNode {
+	return newXNode(t.node.PrevSibling, t.pass)
 }
 
 func (t *tnode) Type() html.NodeType {
@@ -63,10 +201,18 @@ func (t *tnode) Attr() []html.Attribute {
 }
 
 func (t *tnode) SetType(newType html.NodeType) {
+	if t.node.Type == html.DocumentNode || newType == html.DocumentNode || newType == html.RawNode {
+		return
+	}
+	t.changed()
 	t.node.Type = newType
 }
 
 func (t *tnode) SetAtom(newAtom atom.Atom) {
+	if t.node.Type == html.DocumentNode {
+		return
+	}
+	t.changed()
 	t.node.DataAtom = newAtom
 	if t.node.Type == html.ElementNode {
 		t.node.Data = newAtom.String()
@@ -74,9 +220,367 @@ func (t *tnode) SetAtom(newAtom atom.Atom) {
 }
 
 func (t *tnode) SetData(newData string) {
+	if t.node.Type == html.DocumentNode {
+		return
+	}
+	t.changed()
 	t.node.Data = newData
 }
 
 func (t *tnode) SetAttrs(newAttrs []html.Attribute) {
+	if t.node.Type == html.DocumentNode {
+		return
+	}
+	t.changed()
 	t.node.Attr = newAttrs
 }
+
+func (t *tnode) GetAttr(key string) (string, bool) {
+	key = strings.ToLower(key)
+	for _, attr := range t.node.Attr {
+		if attr.Namespace == "" && strings.ToLower(attr.Key) == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func (t *tnode) SetAttr(key string, value string) {
+	if t.node.Type == html.DocumentNode {
+		return
+	}
+	t.changed()
+	lower := strings.ToLower(key)
+	for i, attr := range t.node.Attr {
+		if attr.Namespace == "" && strings.ToLower(attr.Key) == lower {
+			t.node.Attr[i].Val = value
+			return
+		}
+	}
+	t.node.Attr = append(t.node.Attr, html.Attribute{Key: key, Val: value})
+}
+
+func (t *tnode) RemoveAttr(key string) {
+	key = strings.ToLower(key)
+	attrs := t.node.Attr[:0]
+	for _, attr := range t.node.Attr {
+		if attr.Namespace != "" || strings.ToLower(attr.Key) != key {
+			attrs = append(attrs, attr)
+		}
+	}
+	if len(attrs) != len(t.node.Attr) {
+		t.changed()
+	}
+	t.node.Attr = attrs
+}
+
+func (t *tnode) AppendChild(child XNode) {
+	ch := t.other(child)
+	if ch == nil || (t.node.Type != html.ElementNode && t.node.Type != html.DocumentNode) || isAncestor(ch.node, t.node) {
+		return
+	}
+	t.edited(ch)
+	detach(ch.node)
+	t.node.AppendChild(ch.node)
+}
+
+func (t *tnode) InsertBefore(sibling XNode) {
+	s := t.other(sibling)
+	if s == nil || t.node.Parent == nil || isAncestor(s.node, t.node) {
+		return
+	}
+	t.edited(s)
+	detach(s.node)
+	t.node.Parent.InsertBefore(s.node, t.node)
+}
+
+func (t *tnode) InsertAfter(sibling XNode) {
+	s := t.other(sibling)
+	if s == nil || t.node.Parent == nil || isAncestor(s.node, t.node) {
+		return
+	}
+	t.edited(s)
+	detach(s.node)
+	t.node.Parent.InsertBefore(s.node, t.node.NextSibling)
+}
+
+func (t *tnode) ReplaceWith(replacement XNode) {
+	r := t.other(replacement)
+	if r == nil || t.node.Parent == nil || isAncestor(r.node, t.node) {
+		return
+	}
+	t.edited(r)
+	detach(r.node)
+	t.node.Parent.InsertBefore(r.node, t.node)
+	t.node.Parent.RemoveChild(t.node)
+}
+
+func (t *tnode) Wrap(wrapper XNode) {
+	w := t.other(wrapper)
+	if w == nil || w.node.Type != html.ElementNode || t.node.Parent == nil || isAncestor(w.node, t.node) {
+		return
+	}
+	t.edited(w)
+	detach(w.node)
+	t.node.Parent.InsertBefore(w.node, t.node)
+	t.node.Parent.RemoveChild(t.node)
+	w.node.AppendChild(t.node)
+}
+
+func (t *tnode) Unwrap() {
+	p := t.node.Parent
+	if p == nil {
+		return
+	}
+	t.edited(nil)
+	for t.node.FirstChild != nil {
+		ch := t.node.FirstChild
+		t.node.RemoveChild(ch)
+		p.InsertBefore(ch, t.node)
+	}
+	p.RemoveChild(t.node)
+}
+
+func (t *tnode) Remove() {
+	if t.node.Parent != nil {
+		t.edited(nil)
+		t.node.Parent.RemoveChild(t.node)
+	}
+}
+
+// other returns x as a *tnode, or nil if it is not a node created by this package or is
+// the receiver itself
+func (t *tnode) other(x XNode) *tnode {
+	o, ok := x.(*tnode)
+	if !ok || o == nil || o.node == t.node {
+		return nil
+	}
+	return o
+}
+
+// changed notes a change to the receiver's type, tag, data or attributes
+func (t *tnode) changed() {
+	if t.pass != nil && t.node != t.pass.current {
+		t.pass.dirty = true
+	}
+}
+
+// edited notes a change to the structure of the tree made through the receiver, which
+// moves o into the tree if it is non-nil
+func (t *tnode) edited(o *tnode) {
+	p := t.pass
+	if p == nil && o != nil {
+		p = o.pass
+	}
+	if p == nil {
+		return
+	}
+	p.edits++
+	if t.node != p.current {
+		p.dirty = true
+	}
+	if o != nil && o.pass == nil {
+		p.addCreated(o.node)
+	}
+}
+
+// detach removes n from its parent, if it has one
+func detach(n *html.Node) {
+	if n.Parent != nil {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// isAncestor reports whether a is n or one of its ancestors
+func isAncestor(a *html.Node, n *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if n == a {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanPass holds the state of cleaning a tree with transformers, post-transformers or
+// finalizers, which is shared by the traversals of all phases
+type cleanPass struct {
+	transforms []TransformErrFunc
+	phase      TransformPhase
+	// validated records the state of each node as it was last checked against the whitelist
+	validated snapshot
+	// err is the first error returned by a transformer, which ends the traversal
+	err error
+	// current is the node the transformers are being applied to
+	current *html.Node
+	// transformed holds the nodes the phase's transformers have been applied to, and
+	// created the nodes added with NewElement or NewText, which are not transformed
+	transformed map[*html.Node]struct{}
+	created     map[*html.Node]struct{}
+	// edits counts changes to the structure of the tree
+	edits int
+	// dirty is set when a node other than the current one is changed, which the traversal
+	// may already have checked or may no longer reach
+	dirty bool
+	// untracked is set once nodes created with NewElement or NewText are added to the
+	// tree, as changes made to them later can't be noticed
+	untracked bool
+}
+
+func newCleanPass() *cleanPass {
+	return &cleanPass{validated: make(snapshot)}
+}
+
+// begin starts a phase, in which transforms are applied once to each node
+func (p *cleanPass) begin(transforms []TransformErrFunc, phase TransformPhase) {
+	p.transforms = transforms
+	p.phase = phase
+	p.transformed = make(map[*html.Node]struct{})
+	p.created = make(map[*html.Node]struct{})
+}
+
+// shouldTransform reports whether the transformers have yet to be applied to n. It marks
+// n as transformed
+func (p *cleanPass) shouldTransform(n *html.Node) bool {
+	if p == nil || len(p.transforms) == 0 || (n.Type != html.ElementNode && n.Type != html.TextNode) {
+		return false
+	}
+	if _, ok := p.created[n]; ok {
+		return false
+	}
+	if _, ok := p.transformed[n]; ok {
+		return false
+	}
+	p.transformed[n] = struct{}{}
+	return true
+}
+
+// addCreated marks n and its descendants as created by a transformer
+func (p *cleanPass) addCreated(n *html.Node) {
+	p.untracked = true
+	p.created[n] = struct{}{}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		p.addCreated(ch)
+	}
+}
+
+func (p *cleanPass) failed() bool {
+	return p != nil && p.err != nil
+}
+
+func (p *cleanPass) snapshot() snapshot {
+	if p == nil {
+		return nil
+	}
+	return p.validated
+}
+
+// cleanPhase applies transforms to each node of doc as it is cleaned. If a transformer
+// changed nodes the traversal may have missed, doc is traversed again, which only
+// transforms and checks nodes that are new or changed
+func (c *cleaner) cleanPhase(doc *html.Node, r *Report, p *cleanPass, transforms []TransformErrFunc, phase TransformPhase) error {
+	p.begin(transforms, phase)
+	c.cleanRecursive(doc, r, p)
+	for again := p.dirty || p.untracked; again && p.err == nil; again = p.dirty {
+		p.dirty = false
+		c.cleanRecursive(doc, r, p)
+	}
+	return p.err
+}
+
+// transform applies each transformer in turn to n, returning the node that has taken its
+// place, or nil if it was removed. If a transformer returns an error, it is recorded in p
+// and the remaining transformers are skipped
+func (c *cleaner) transform(n *html.Node, p *cleanPass) *html.Node {
+	for i, transform := range p.transforms {
+		p.current = n
+		transformed, err := transform(newXNode(n, p))
+		p.current = nil
+		if err != nil {
+			p.err = &TransformError{Phase: p.phase, Index: i, Node: n, Err: err}
+			return n
+		}
+		if n.Parent == nil {
+			// the transformer removed or replaced the node itself
+			return nil
+		}
+		if transformed == nil {
+			n.Parent.RemoveChild(n)
+			p.edits++
+			return nil
+		}
+
+		t, ok := transformed.(*tnode)
+		if !ok || t.node == n || isAncestor(t.node, n) {
+			continue
+		}
+		if t.pass == nil {
+			p.addCreated(t.node)
+		}
+		detach(t.node)
+		n.Parent.InsertBefore(t.node, n)
+		n.Parent.RemoveChild(n)
+		p.edits++
+		n = t.node
+		p.transformed[n] = struct{}{}
+	}
+	return n
+}
+
+// snapshot records the state of nodes that have been checked against the whitelist, so
+// that they can be told apart from nodes added or changed since
+type snapshot map[*html.Node]nodeState
+
+type nodeState struct {
+	nodeType html.NodeType
+	atom     atom.Atom
+	data     string
+	attrs    []html.Attribute
+}
+
+// record adds the current state of n to the snapshot
+func (s snapshot) record(n *html.Node) {
+	if s == nil {
+		return
+	}
+	attrs := make([]html.Attribute, len(n.Attr))
+	copy(attrs, n.Attr)
+	s[n] = nodeState{nodeType: n.Type, atom: n.DataAtom, data: n.Data, attrs: attrs}
+}
+
+// unchanged reports whether n is in the snapshot and has not changed since
+func (s snapshot) unchanged(n *html.Node) bool {
+	state, ok := s.state(n)
+	if !ok || len(state.attrs) != len(n.Attr) {
+		return false
+	}
+	for i, attr := range n.Attr {
+		if attr != state.attrs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// trusts reports whether attr was present on n, when n had the same type and tag, at the
+// time of the snapshot
+func (s snapshot) trusts(n *html.Node, attr html.Attribute) bool {
+	state, ok := s.state(n)
+	if !ok {
+		return false
+	}
+	for _, a := range state.attrs {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// state returns the recorded state of n, provided its type, tag and data are unchanged
+func (s snapshot) state(n *html.Node) (nodeState, bool) {
+	state, ok := s[n]
+	if !ok || state.nodeType != n.Type || state.atom != n.DataAtom || state.data != n.Data {
+		return nodeState{}, false
+	}
+	return state, true
+}
@@ -1,6 +1,8 @@
 package gsoup
 
 import (
+	"errors"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -179,3 +181,429 @@ func Test_ShouldApplyMultipleTransformers(t *testing.T) {
 	assert.Equal(t, `<i>a<b>b</b></i><b>c</b>`, actual)
 
 }
+
+func Test_XNode_Navigation(t *testing.T) {
+	doc, _ := html.Parse(strings.NewReader(`<p><b>1</b><i>2</i><u>3</u></p>`))
+	p := newCleanPass()
+	body := doc.FirstChild.LastChild
+	x := newXNode(body.FirstChild.FirstChild.NextSibling, p)
+
+	assert.Equal(t, atom.I, x.Atom())
+	assert.Equal(t, atom.B, x.PrevSibling().Atom())
+	assert.Equal(t, atom.U, x.NextSibling().Atom())
+	assert.Nil(t, x.NextSibling().NextSibling())
+	assert.Nil(t, x.PrevSibling().PrevSibling())
+	assert.Equal(t, atom.P, x.Parent().Atom())
+	assert.Equal(t, atom.Html, x.Parent().Parent().Parent().Atom())
+	assert.Nil(t, x.Parent().Parent().Parent().Parent(), "the document node should not be exposed")
+	assert.Equal(t, "2", x.FirstChild().Data())
+	assert.Nil(t, x.FirstChild().FirstChild())
+	assert.Equal(t, 0, p.edits)
+}
+
+func Test_XNode_Attributes(t *testing.T) {
+	x := NewElement(atom.A, html.Attribute{Key: "href", Val: "/a"}, html.Attribute{Namespace: "xlink", Key: "title", Val: "ns"})
+
+	val, ok := x.GetAttr("HREF")
+	assert.True(t, ok)
+	assert.Equal(t, "/a", val)
+	_, ok = x.GetAttr("title")
+	assert.False(t, ok, "namespaced attributes should not match")
+
+	x.SetAttr("href", "/b")
+	x.SetAttr("title", "t")
+	assert.Equal(t, []html.Attribute{{Key: "href", Val: "/b"}, {Namespace: "xlink", Key: "title", Val: "ns"}, {Key: "title", Val: "t"}}, x.Attr())
+
+	x.RemoveAttr("Href")
+	x.RemoveAttr("missing")
+	assert.Equal(t, []html.Attribute{{Namespace: "xlink", Key: "title", Val: "ns"}, {Key: "title", Val: "t"}}, x.Attr())
+}
+
+func Test_XNode_TreeEditing(t *testing.T) {
+	for name, test := range treeEditTests {
+		c := NewEmptyCleaner().AddTags(T(atom.B), T(atom.I), T(atom.U), T(atom.P, "class"), T(atom.Div))
+		c.AddTransformer(test.transform)
+		actual, err := c.CleanString(test.input)
+		assert.Nil(t, err, name)
+		assert.Equal(t, test.expected, actual, name)
+	}
+}
+
+func Test_ShouldContinueTraversalAfterRemoval(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.B), T(atom.I))
+	c.AddTransformer(func(x XNode) XNode {
+		if x.Atom() == atom.B {
+			return nil
+		}
+		if x.Type() == html.TextNode {
+			x.SetData(strings.ToUpper(x.Data()))
+		}
+		return x
+	})
+	actual, err := c.CleanString(`<i>a</i><b>b</b><i>c</i>d`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<i>A</i><i>C</i>D`, actual)
+}
+
+func Test_ShouldTransformEachNodeOnce(t *testing.T) {
+	counts := make(map[string]int)
+	c := NewEmptyCleaner().AddTags(T(atom.B), T(atom.I), T(atom.Div))
+	c.AddTransformer(func(x XNode) XNode {
+		if x.Type() == html.TextNode {
+			counts[x.Data()]++
+			return x
+		}
+		if x.Atom() == atom.I {
+			// move an earlier sibling after this node, and wrap this node
+			x.InsertAfter(x.PrevSibling())
+			x.Wrap(NewElement(atom.Div))
+		}
+		return x
+	})
+	actual, err := c.CleanString(`<b>1</b><i>2</i><b>3</b>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<div><i>2</i></div><b>1</b><b>3</b>`, actual)
+	assert.Equal(t, map[string]int{"1": 1, "2": 1, "3": 1}, counts)
+}
+
+func Test_ShouldTransformNodesMovedBehindTraversal(t *testing.T) {
+	counts := make(map[string]int)
+	c := NewEmptyCleaner().AddTags(T(atom.B), T(atom.I), T(atom.P))
+	c.AddTransformer(func(x XNode) XNode {
+		if x.Type() == html.TextNode {
+			counts[x.Data()]++
+			x.SetData(strings.ToUpper(x.Data()))
+		} else if x.Atom() == atom.I {
+			// move the next sibling to a position the traversal has passed
+			x.Parent().InsertBefore(x.NextSibling())
+		}
+		return x
+	})
+	actual, err := c.CleanString(`<p>a<i>b</i><b onclick="x">c</b></p>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<b>C</b><p>A<i>B</i></p>`, actual)
+	assert.Equal(t, map[string]int{"a": 1, "b": 1, "c": 1}, counts)
+}
+
+func Test_ShouldOnlyCountEditsMade(t *testing.T) {
+	doc, _ := html.Parse(strings.NewReader(`<p><b>1</b></p>`))
+	p := newCleanPass()
+	b := doc.FirstChild.LastChild.FirstChild.FirstChild
+	p.current = b
+	x := newXNode(b, p)
+
+	x.AppendChild(x.Parent())
+	x.Wrap(NewText("t"))
+	x.InsertBefore(x)
+	x.FirstChild().AppendChild(x)
+	newXNode(doc, p).SetAttr("k", "v")
+	assert.Equal(t, 0, p.edits)
+	assert.False(t, p.dirty)
+
+	x.SetAttr("class", "c")
+	x.RemoveAttr("missing")
+	assert.False(t, p.dirty, "changes to the current node should not require another traversal")
+
+	x.FirstChild().SetData("2")
+	assert.Equal(t, 0, p.edits)
+	assert.True(t, p.dirty)
+
+	x.Unwrap()
+	assert.Equal(t, 1, p.edits)
+}
+
+func Test_ShouldValidateNodesEditedByTransformers(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.B), T(atom.I))
+	c.AddTransformer(func(x XNode) XNode {
+		if x.Atom() == atom.I {
+			x.Parent().SetAttr("onclick", "alert(1)")
+			x.InsertBefore(NewElement(atom.Script))
+			x.PrevSibling().AppendChild(NewText("alert(2)"))
+			x.Parent().InsertAfter(NewElement(atom.Iframe))
+		}
+		return x
+	})
+	actual, err := c.CleanString(`<b>x<i>y</i></b>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<b>x<i>y</i></b>`, actual)
+}
+
+type treeEditTest struct {
+	input     string
+	transform TransformFunc
+	expected  string
+}
+
+var treeEditTests = map[string]treeEditTest{
+	"wrap": {`<b>1</b><i>2</i>`, func(x XNode) XNode {
+		if x.Atom() == atom.B {
+			x.Wrap(NewElement(atom.P, html.Attribute{Key: "class", Val: "w"}))
+		}
+		return x
+	}, `<p class="w"><b>1</b></p><i>2</i>`},
+	"unwrap": {`<div><b>1</b>2<i>3</i></div><u>4</u>`, func(x XNode) XNode {
+		if x.Atom() == atom.Div {
+			x.Unwrap()
+		}
+		return x
+	}, `<b>1</b>2<i>3</i><u>4</u>`},
+	"unwrap parent": {`<div><b>1</b><i>2</i><u>3</u></div>`, func(x XNode) XNode {
+		if x.Atom() == atom.I {
+			x.Parent().Unwrap()
+		}
+		return x
+	}, `<b>1</b><i>2</i><u>3</u>`},
+	"insert before and after": {`<b>1</b>`, func(x XNode) XNode {
+		if x.Atom() == atom.B {
+			x.InsertBefore(NewText("<"))
+			x.InsertAfter(NewElement(atom.I))
+			x.NextSibling().AppendChild(NewText(">"))
+		}
+		return x
+	}, `&lt;<b>1</b><i>&gt;</i>`},
+	"replace with": {`<b>1</b><i>2</i>`, func(x XNode) XNode {
+		if x.Atom() == atom.B {
+			u := NewElement(atom.U)
+			u.AppendChild(x.FirstChild())
+			x.ReplaceWith(u)
+		}
+		return x
+	}, `<u>1</u><i>2</i>`},
+	"remove": {`<b>1</b><i>2</i><u>3</u>`, func(x XNode) XNode {
+		if x.Atom() == atom.I {
+			x.NextSibling().Remove()
+			x.Remove()
+		}
+		return x
+	}, `<b>1</b>`},
+	"return new node": {`<b>1</b><i>2</i>`, func(x XNode) XNode {
+		if x.Atom() == atom.B {
+			return NewText("bold")
+		}
+		return x
+	}, `bold<i>2</i>`},
+	"cycles ignored": {`<b><i>1</i></b>`, func(x XNode) XNode {
+		if x.Atom() == atom.I {
+			x.AppendChild(x.Parent())
+			x.Wrap(x.Parent())
+			x.InsertBefore(x)
+			x.FirstChild().AppendChild(x)
+			return x.Parent()
+		}
+		return x
+	}, `<b><i>1</i></b>`},
+}
+
+func Test_ShouldRunPhasesInOrder(t *testing.T) {
+	var log []string
+	c := NewEmptyCleaner().AddTags(T(atom.B))
+	c.AddFinalizer(func(x XNode) {
+		log = append(log, "finalize "+x.FirstChild().Data())
+	})
+	c.AddPostTransformer(func(x XNode) XNode {
+		log = append(log, "post "+x.Data())
+		return x
+	})
+	c.AddTransformer(func(x XNode) XNode {
+		log = append(log, "pre "+x.Data())
+		return x
+	})
+	actual, err := c.CleanString(`<b>x</b><script>y</script>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<b>x</b>`, actual)
+	assert.Equal(t, []string{
+		"pre html", "pre head", "pre body", "pre b", "pre x", "pre script",
+		"post b", "post x",
+		"finalize b",
+	}, log)
+}
+
+func Test_ShouldRevalidatePostTransformerOutput(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.Img, "src", "loading"), T(atom.B), T(atom.I))
+	c.AddPostTransformer(func(x XNode) XNode {
+		switch x.Atom() {
+		case atom.Img:
+			x.SetAttr("loading", "lazy")
+			x.SetAttr("onerror", "alert(1)")
+		case atom.B:
+			x.SetAtom(atom.Script)
+		case atom.I:
+			x.InsertAfter(NewElement(atom.Iframe))
+			x.AppendChild(NewText("!"))
+		}
+		return x
+	})
+	actual, err := c.CleanString(`<img src="http://example.com/a.png"><b>x</b><i>y</i>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<img src="http://example.com/a.png" loading="lazy"/><i>y!</i>`, actual)
+}
+
+func Test_ShouldNotAllowRawNodes(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.P))
+	c.AddPostTransformer(func(x XNode) XNode {
+		if x.Type() == html.TextNode {
+			x.SetType(html.RawNode)
+			x.SetData("<script>alert(1)</script>")
+		}
+		return x
+	})
+	actual, err := c.CleanString(`<p>text</p>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>`, actual)
+
+	c = NewEmptyCleaner().AddTags(T(atom.P))
+	c.AddTransformer(func(x XNode) XNode {
+		if x.Type() == html.TextNode {
+			x.SetType(html.DocumentNode)
+		}
+		return x
+	})
+	actual, err = c.CleanString(`<p>text</p>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<p>text</p>`, actual)
+}
+
+func Test_ShouldNotRevalidateUnchangedAttributes(t *testing.T) {
+	c := NewBasicCleanerWithImages().
+		AllowHosts("example.com").
+		RewriteURLs(CamoRewriter("https://camo.example", []byte("secret")))
+	c.AddPostTransformer(func(x XNode) XNode {
+		if x.Atom() == atom.Img {
+			x.SetAttr("alt", "a")
+		}
+		return x
+	})
+	actual, err := c.CleanString(`<img src="http://example.com/a.png">`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<img src="https://camo.example/ecc8ab72d767428b6effbb61fe613f3100901b75/687474703a2f2f6578616d706c652e636f6d2f612e706e67" alt="a"/>`, actual)
+}
+
+func Test_ShouldApplyFinalizers(t *testing.T) {
+	c := NewEmptyCleaner().AddTags(T(atom.A, "href"), T(atom.P))
+	c.AddFinalizer(func(x XNode) {
+		x.SetType(html.TextNode)
+		x.SetData("wot")
+		x.SetAttr("x", "y")
+
+		links := 0
+		var count func(XNode)
+		count = func(n XNode) {
+			for ch := n.FirstChild(); ch != nil; ch = ch.NextSibling() {
+				if ch.Atom() == atom.A {
+					links++
+				}
+				count(ch)
+			}
+		}
+		count(x)
+
+		footer := NewElement(atom.P, html.Attribute{Key: "onclick", Val: "alert(1)"})
+		footer.AppendChild(NewText(strconv.Itoa(links) + " links"))
+		x.AppendChild(footer)
+	})
+	actual, err := c.CleanString(`<a href="http://a.com">a</a><a href="javascript:alert(1)">b</a><a>c</a>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<a href="http://a.com">a</a><a>b</a><a>c</a><p>3 links</p>`, actual)
+}
+
+var errBanned = errors.New("banned word")
+
+func Test_ShouldAbortOnTransformerError(t *testing.T) {
+	visited := 0
+	c := NewEmptyCleaner().AddTags(T(atom.P))
+	c.AddTransformer(func(x XNode) XNode {
+		visited++
+		return x
+	})
+	c.AddTransformerE(func(x XNode) (XNode, error) {
+		if x.Type() == html.TextNode && strings.Contains(x.Data(), "darn") {
+			return x, errBanned
+		}
+		return x, nil
+	})
+
+	input := `<p>fine</p><p>darn it</p><p>never seen</p>`
+	actual, err := c.CleanString(input)
+	assert.Equal(t, "", actual)
+	terr, ok := err.(*TransformError)
+	assert.True(t, ok)
+	assert.Equal(t, PhaseTransform, terr.Phase)
+	assert.Equal(t, 1, terr.Index)
+	assert.Equal(t, "darn it", terr.Node.Data)
+	assert.Equal(t, errBanned, terr.Unwrap())
+	assert.Equal(t, "gsoup: transformer 1 failed on text in p: banned word", err.Error())
+	assert.Equal(t, 7, visited, "the traversal should stop at the error")
+
+	doc, err := c.Clean(strings.NewReader(input))
+	assert.Nil(t, doc)
+	assert.Equal(t, terr.Error(), err.Error())
+
+	doc, report, err := c.CleanWithReport(strings.NewReader(input))
+	assert.Nil(t, doc)
+	assert.NotNil(t, report)
+	assert.Equal(t, terr.Error(), err.Error())
+
+	root, _ := html.Parse(strings.NewReader(input))
+	doc, err = c.CleanNode(root)
+	assert.Nil(t, doc)
+	assert.Equal(t, terr.Error(), err.Error())
+
+	assert.Nil(t, c.Validate(strings.NewReader(input)), "validation should not run transformers")
+}
+
+func Test_ShouldAbortOnPostTransformerError(t *testing.T) {
+	links := 0
+	c := NewEmptyCleaner().AddTags(T(atom.A, "href"))
+	c.AddPostTransformerE(func(x XNode) (XNode, error) {
+		if x.Atom() == atom.A {
+			if links++; links > 2 {
+				return x, errors.New("too many links")
+			}
+		}
+		return x, nil
+	})
+
+	actual, err := c.CleanString(`<a href="http://a.com">1</a><script>x</script><a>2</a>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<a href="http://a.com">1</a><a>2</a>`, actual)
+
+	links = 0
+	_, err = c.CleanString(`<a>1</a><a>2</a><a>3</a>`)
+	terr, ok := err.(*TransformError)
+	assert.True(t, ok)
+	assert.Equal(t, PhasePostTransform, terr.Phase)
+	assert.Equal(t, "gsoup: post-transformer 0 failed on element <a>: too many links", err.Error())
+}
+
+func Test_ShouldAbortOnFinalizerError(t *testing.T) {
+	var called []int
+	c := NewEmptyCleaner().AddTags(T(atom.P))
+	c.AddFinalizer(func(x XNode) {
+		called = append(called, 0)
+	})
+	c.AddFinalizerE(func(x XNode) error {
+		called = append(called, 1)
+		if x.FirstChild() == nil {
+			return errors.New("empty")
+		}
+		return nil
+	})
+	c.AddFinalizer(func(x XNode) {
+		called = append(called, 2)
+	})
+
+	actual, err := c.CleanString(`<p>x</p>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<p>x</p>`, actual)
+	assert.Equal(t, []int{0, 1, 2}, called)
+
+	called = nil
+	_, err = c.CleanString(`<script>x</script>`)
+	terr, ok := err.(*TransformError)
+	assert.True(t, ok)
+	assert.Equal(t, PhaseFinalize, terr.Phase)
+	assert.Equal(t, 1, terr.Index)
+	assert.Equal(t, html.DocumentNode, terr.Node.Type)
+	assert.Equal(t, "gsoup: finalizer 1 failed on document: empty", err.Error())
+	assert.Equal(t, []int{0, 1}, called)
+}
@@ -0,0 +1,259 @@
+// Package transformers provides ready-made gsoup transformers for common normalizations
+//
+// Each transformer leaves nodes it doesn't apply to untouched, so any number of them can
+// be added to a cleaner. Their output is still checked against the cleaner's whitelist:
+// e.g. the loading attribute added by LazyImages is removed unless img allows it
+package transformers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/neocortical/gsoup"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var headings = []atom.Atom{atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6}
+
+// inlineElements are the phrasing elements that StripEmptyInline may remove
+var inlineElements = map[atom.Atom]struct{}{
+	atom.Abbr:   struct{}{},
+	atom.B:      struct{}{},
+	atom.Bdi:    struct{}{},
+	atom.Bdo:    struct{}{},
+	atom.Cite:   struct{}{},
+	atom.Code:   struct{}{},
+	atom.Del:    struct{}{},
+	atom.Dfn:    struct{}{},
+	atom.Em:     struct{}{},
+	atom.Font:   struct{}{},
+	atom.I:      struct{}{},
+	atom.Ins:    struct{}{},
+	atom.Kbd:    struct{}{},
+	atom.Mark:   struct{}{},
+	atom.Q:      struct{}{},
+	atom.S:      struct{}{},
+	atom.Samp:   struct{}{},
+	atom.Small:  struct{}{},
+	atom.Span:   struct{}{},
+	atom.Strike: struct{}{},
+	atom.Strong: struct{}{},
+	atom.Sub:    struct{}{},
+	atom.Sup:    struct{}{},
+	atom.Time:   struct{}{},
+	atom.Tt:     struct{}{},
+	atom.U:      struct{}{},
+	atom.Var:    struct{}{},
+}
+
+// fontSizes maps the legacy font sizes 1 to 7 to CSS font sizes
+var fontSizes = []string{"x-small", "small", "medium", "large", "x-large", "xx-large", "3em"}
+
+// BoldToStrong replaces <b> elements with <strong>
+func BoldToStrong(x gsoup.XNode) gsoup.XNode {
+	if isElement(x, atom.B) {
+		x.SetAtom(atom.Strong)
+	}
+	return x
+}
+
+// ItalicToEm replaces <i> elements with <em>
+func ItalicToEm(x gsoup.XNode) gsoup.XNode {
+	if isElement(x, atom.I) {
+		x.SetAtom(atom.Em)
+	}
+	return x
+}
+
+// DemoteHeadings returns a transformer that lowers the level of headings by the given
+// number of levels, e.g. turning <h1> into <h3> for 2. Headings that would fall below
+// <h6> become <h6>
+func DemoteHeadings(levels int) gsoup.TransformFunc {
+	return func(x gsoup.XNode) gsoup.XNode {
+		if x.Type() != html.ElementNode {
+			return x
+		}
+		for i, heading := range headings {
+			if x.Atom() == heading {
+				i += levels
+				if i < 0 {
+					i = 0
+				} else if i >= len(headings) {
+					i = len(headings) - 1
+				}
+				x.SetAtom(headings[i])
+				break
+			}
+		}
+		return x
+	}
+}
+
+// StripEmptyInline removes inline elements such as <b>, <em> or <span> that contain no
+// text other than whitespace, which is kept. Elements with an id are left in place, as
+// they may be link targets
+func StripEmptyInline(x gsoup.XNode) gsoup.XNode {
+	if x.Type() != html.ElementNode {
+		return x
+	}
+	if _, ok := inlineElements[x.Atom()]; !ok {
+		return x
+	}
+	if _, ok := x.GetAttr("id"); ok || !isEmptyInline(x) {
+		return x
+	}
+	x.Unwrap()
+	return x
+}
+
+// CollapseBreaks returns a transformer that removes <br> elements following max
+// consecutive <br> elements. Whitespace between the elements is ignored
+func CollapseBreaks(max int) gsoup.TransformFunc {
+	if max < 1 {
+		max = 1
+	}
+	return func(x gsoup.XNode) gsoup.XNode {
+		if !isElement(x, atom.Br) {
+			return x
+		}
+		count := 0
+		for s := x.PrevSibling(); s != nil && count < max; s = s.PrevSibling() {
+			if isElement(s, atom.Br) {
+				count++
+			} else if !isWhitespace(s) {
+				break
+			}
+		}
+		if count >= max {
+			return nil
+		}
+		return x
+	}
+}
+
+// UnwrapSpans replaces <span> elements that have no attributes with their children.
+// Added with AddPostTransformer, it also unwraps spans whose attributes were all removed
+func UnwrapSpans(x gsoup.XNode) gsoup.XNode {
+	if isElement(x, atom.Span) && len(x.Attr()) == 0 {
+		x.Unwrap()
+	}
+	return x
+}
+
+// LazyImages adds loading="lazy" and decoding="async" to <img> elements that don't
+// already specify them
+func LazyImages(x gsoup.XNode) gsoup.XNode {
+	if !isElement(x, atom.Img) {
+		return x
+	}
+	if _, ok := x.GetAttr("loading"); !ok {
+		x.SetAttr("loading", "lazy")
+	}
+	if _, ok := x.GetAttr("decoding"); !ok {
+		x.SetAttr("decoding", "async")
+	}
+	return x
+}
+
+// FontToSpan replaces <font> elements with <span>, converting the color, face and size
+// attributes to the color, font-family and font-size styles
+func FontToSpan(x gsoup.XNode) gsoup.XNode {
+	if !isElement(x, atom.Font) {
+		return x
+	}
+	var styles []string
+	if color, ok := x.GetAttr("color"); ok && safeStyleValue(color) {
+		styles = append(styles, "color: "+strings.TrimSpace(color))
+	}
+	if face, ok := x.GetAttr("face"); ok && safeStyleValue(face) {
+		styles = append(styles, "font-family: "+strings.TrimSpace(face))
+	}
+	if size, ok := x.GetAttr("size"); ok {
+		if fontSize, ok := cssFontSize(size); ok {
+			styles = append(styles, "font-size: "+fontSize)
+		}
+	}
+	x.RemoveAttr("color")
+	x.RemoveAttr("face")
+	x.RemoveAttr("size")
+	x.SetAtom(atom.Span)
+	addStyles(x, styles)
+	return x
+}
+
+// CenterToDiv replaces <center> elements with <div style="text-align: center">
+func CenterToDiv(x gsoup.XNode) gsoup.XNode {
+	if isElement(x, atom.Center) {
+		x.SetAtom(atom.Div)
+		addStyles(x, []string{"text-align: center"})
+	}
+	return x
+}
+
+func isElement(x gsoup.XNode, a atom.Atom) bool {
+	return x.Type() == html.ElementNode && x.Atom() == a
+}
+
+func isWhitespace(x gsoup.XNode) bool {
+	return x.Type() == html.TextNode && strings.TrimSpace(x.Data()) == ""
+}
+
+// isEmptyInline reports whether x contains only whitespace, comments and empty inline
+// elements
+func isEmptyInline(x gsoup.XNode) bool {
+	for ch := x.FirstChild(); ch != nil; ch = ch.NextSibling() {
+		switch ch.Type() {
+		case html.TextNode:
+			if !isWhitespace(ch) {
+				return false
+			}
+		case html.ElementNode:
+			if _, ok := inlineElements[ch.Atom()]; !ok || !isEmptyInline(ch) {
+				return false
+			}
+		case html.CommentNode:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// safeStyleValue reports whether a legacy attribute value can be copied into a CSS
+// declaration without changing the meaning of the style attribute
+func safeStyleValue(val string) bool {
+	val = strings.TrimSpace(val)
+	return val != "" && !strings.ContainsAny(val, `;:"'(){}\<>/`)
+}
+
+// cssFontSize converts a legacy font size, from 1 to 7 or relative to 3 with a sign, to
+// a CSS font size
+func cssFontSize(size string) (string, bool) {
+	size = strings.TrimSpace(size)
+	n, err := strconv.Atoi(strings.TrimPrefix(size, "+"))
+	if err != nil {
+		return "", false
+	}
+	if strings.HasPrefix(size, "+") || strings.HasPrefix(size, "-") {
+		n += 3
+	}
+	if n < 1 {
+		n = 1
+	} else if n > len(fontSizes) {
+		n = len(fontSizes)
+	}
+	return fontSizes[n-1], true
+}
+
+// addStyles prepends CSS declarations to x's style attribute
+func addStyles(x gsoup.XNode, styles []string) {
+	if len(styles) == 0 {
+		return
+	}
+	style := strings.Join(styles, "; ")
+	if existing, ok := x.GetAttr("style"); ok && strings.TrimSpace(existing) != "" {
+		style += "; " + strings.TrimSpace(existing)
+	}
+	x.SetAttr("style", style)
+}
@@ -0,0 +1,68 @@
+package transformers
+
+import (
+	"testing"
+
+	"github.com/neocortical/gsoup"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html/atom"
+)
+
+func Test_Transformers(t *testing.T) {
+	for name, test := range transformerTests {
+		c := testCleaner()
+		if test.post {
+			c.AddPostTransformer(test.transform)
+		} else {
+			c.AddTransformer(test.transform)
+		}
+		actual, err := c.CleanString(test.input)
+		assert.Nil(t, err, name)
+		assert.Equal(t, test.expected, actual, name)
+	}
+}
+
+func Test_Transformers_combined(t *testing.T) {
+	c := gsoup.NewBasicCleaner()
+	c.AddTransformer(BoldToStrong)
+	c.AddTransformer(ItalicToEm)
+	c.AddTransformer(FontToSpan)
+	c.AddTransformer(StripEmptyInline)
+	c.AddPostTransformer(UnwrapSpans)
+	actual, err := c.CleanString(`<p><b>bold</b> <font color="red"><i>it</i></font><b> </b><i></i></p>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<p><strong>bold</strong> <em>it</em> </p>`, actual)
+}
+
+func testCleaner() gsoup.Cleaner {
+	return gsoup.NewRelaxedCleaner().AddTags(
+		gsoup.T(atom.Span, "id", "class").AllowStyles("color", "font-family", "font-size"),
+		gsoup.T(atom.Div).AllowStyles("text-align", "color"),
+		gsoup.T(atom.Img, "src", "loading", "decoding").EnforceProtocols("src", "http", "https"),
+	)
+}
+
+type transformerTest struct {
+	transform gsoup.TransformFunc
+	post      bool
+	input     string
+	expected  string
+}
+
+var transformerTests = map[string]transformerTest{
+	"b to strong":               {BoldToStrong, false, `<b>x</b><i>y</i>`, `<strong>x</strong><i>y</i>`},
+	"i to em":                   {ItalicToEm, false, `<b>x</b><i>y</i>`, `<b>x</b><em>y</em>`},
+	"demote headings":           {DemoteHeadings(2), false, `<h1>1</h1><h2>2</h2><h4>4</h4><h6>6</h6><p>p</p>`, `<h3>1</h3><h4>2</h4><h6>4</h6><h6>6</h6><p>p</p>`},
+	"promote headings":          {DemoteHeadings(-1), false, `<h1>1</h1><h3>3</h3>`, `<h1>1</h1><h2>3</h2>`},
+	"strip empty inline":        {StripEmptyInline, false, `<p>a<b></b>b<em> </em>c<span><i></i></span>d<b>e</b><strong><img src="http://a.com/x.png"/></strong></p>`, `<p>ab cd<b>e</b><strong><img src="http://a.com/x.png"/></strong></p>`},
+	"keep empty inline with id": {StripEmptyInline, false, `<span id="top"></span><p></p>`, `<span id="top"></span><p></p>`},
+	"collapse breaks":           {CollapseBreaks(1), false, `a<br>b<br><br> <br>c`, `a<br/>b<br/> c`},
+	"collapse breaks max 2":     {CollapseBreaks(2), false, `a<br><br><br><br>b<br>`, `a<br/><br/>b<br/>`},
+	"unwrap spans":              {UnwrapSpans, false, `<span>a<span class="x">b</span></span>c`, `a<span class="x">b</span>c`},
+	"unwrap stripped spans":     {UnwrapSpans, true, `<span onclick="x()">a</span><span class="x">b</span>`, `a<span class="x">b</span>`},
+	"lazy images":               {LazyImages, true, `<img src="http://a.com/x.png"><img src="http://a.com/y.png" loading="eager">`, `<img src="http://a.com/x.png" loading="lazy" decoding="async"/><img src="http://a.com/y.png" loading="eager" decoding="async"/>`},
+	"font to span":              {FontToSpan, false, `<font color="#ff0000" face="Arial, sans-serif" size="+2" style="color: blue">x</font>`, `<span style="color: #ff0000; font-family: Arial, sans-serif; font-size: x-large; color: blue">x</span>`},
+	"font sizes":                {FontToSpan, false, `<font size="1">a</font><font size="-3">b</font><font size="9">c</font><font size="big">d</font>`, `<span style="font-size: x-small">a</span><span style="font-size: x-small">b</span><span style="font-size: 3em">c</span><span>d</span>`},
+	"font unsafe values":        {FontToSpan, false, `<font color="red; background: url(x)" face="a:b">x</font>`, `<span>x</span>`},
+	"center to div":             {CenterToDiv, false, `<center style="color: red">x</center>`, `<div style="text-align: center; color: red">x</div>`},
+}
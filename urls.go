@@ -0,0 +1,184 @@
+package gsoup
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/idna"
+)
+
+// TrackingParams are the query parameters stripped by NormalizeURLs by default. Names
+// may be wildcard patterns, e.g. "utm_*"
+var TrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "yclid",
+	"mc_cid", "mc_eid", "igshid", "_hsenc", "_hsmi", "mkt_tok", "oly_anon_id", "oly_enc_id",
+}
+
+// defaultPorts maps schemes to the ports removed from their URLs during normalization
+var defaultPorts = map[string]string{
+	"ftp":   "21",
+	"http":  "80",
+	"https": "443",
+}
+
+// canonicalizeURL normalizes a URL as browsers do before parsing it: leading and trailing
+// C0 control characters and spaces are removed, as are tabs and newlines anywhere in the
+// URL. URLs that still contain control characters are rejected, as are URLs with a
+// backslash before the query, which browsers treat as a slash
+func canonicalizeURL(rawURL string) (string, error) {
+	rawURL = strings.TrimFunc(rawURL, func(r rune) bool {
+		return r <= ' '
+	})
+	rawURL = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, rawURL)
+
+	for i := 0; i < len(rawURL); i++ {
+		if rawURL[i] < ' ' || rawURL[i] == 0x7f {
+			return "", errorInvalidURL
+		}
+	}
+
+	end := strings.IndexAny(rawURL, "?#")
+	if end < 0 {
+		end = len(rawURL)
+	}
+	if strings.IndexByte(rawURL[:end], '\\') >= 0 {
+		return "", errorInvalidURL
+	}
+	return rawURL, nil
+}
+
+// decodedScheme returns the scheme of a URL after decoding any HTML entities, e.g. the
+// "javascript" in "&#106;avascript:", or "" if it has none
+func decodedScheme(rawURL string) (string, error) {
+	decoded, err := canonicalizeURL(html.UnescapeString(rawURL))
+	if err != nil {
+		return "", err
+	}
+	return urlScheme(decoded), nil
+}
+
+// urlScheme returns the lowercased scheme of a URL, or "" if it has none
+func urlScheme(rawURL string) string {
+	for i := 0; i < len(rawURL); i++ {
+		ch := rawURL[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z':
+		case ch >= '0' && ch <= '9', ch == '+', ch == '-', ch == '.':
+			if i == 0 {
+				return ""
+			}
+		case ch == ':':
+			if i == 0 {
+				return ""
+			}
+			return strings.ToLower(rawURL[:i])
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// specialSchemes are the schemes whose URLs browsers always give a host, skipping any
+// number of slashes after the colon, including none
+var specialSchemes = map[string]struct{}{
+	"ftp":   struct{}{},
+	"http":  struct{}{},
+	"https": struct{}{},
+	"ws":    struct{}{},
+	"wss":   struct{}{},
+}
+
+// withAuthority rewrites a URL with a special scheme into the scheme://host/... form
+// browsers resolve it to, e.g. "https:evil.example" or "http:/evil.example", and a
+// scheme-relative URL into the //host/... form. net/url only finds the host when there
+// are exactly two slashes
+func withAuthority(rawURL string) string {
+	if isSchemeRelative(rawURL) {
+		// the same applies to scheme-relative URLs on pages with a special scheme
+		return "//" + strings.TrimLeft(rawURL, "/")
+	}
+	scheme := urlScheme(rawURL)
+	if _, ok := specialSchemes[scheme]; !ok {
+		return rawURL
+	}
+	rest := rawURL[len(scheme)+1:]
+	if strings.HasPrefix(rest, "//") && !strings.HasPrefix(rest, "///") {
+		return rawURL
+	}
+	return rawURL[:len(scheme)] + "://" + strings.TrimLeft(rest, "/")
+}
+
+// parseURL parses a URL as browsers would resolve it when the page's scheme differs
+func parseURL(rawURL string) (*url.URL, error) {
+	return url.Parse(withAuthority(rawURL))
+}
+
+// isSchemeRelative reports whether a URL is scheme-relative, e.g. "//example.com/x"
+func isSchemeRelative(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "//")
+}
+
+// normalizeURL lowercases the scheme and host of u, converts an internationalized host to
+// punycode, removes the scheme's default port and strips query parameters whose names
+// match stripParams. The order and encoding of the remaining parameters is preserved
+func normalizeURL(u *url.URL, stripParams []string) {
+	if u.Opaque != "" {
+		return
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	if u.Host != "" {
+		host, port := strings.ToLower(u.Hostname()), u.Port()
+		if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+			host = ascii
+		}
+		if port == defaultPorts[u.Scheme] {
+			port = ""
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" {
+			host += ":" + port
+		}
+		u.Host = host
+	}
+
+	if u.RawQuery == "" || len(stripParams) == 0 {
+		return
+	}
+	var kept []string
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		name := param
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name = name[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !matchParam(stripParams, strings.ToLower(name)) {
+			kept = append(kept, param)
+		}
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	if u.RawQuery == "" {
+		u.ForceQuery = false
+	}
+}
+
+// matchParam reports whether a query parameter name matches any of the patterns
+func matchParam(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package gsoup
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html/atom"
+)
+
+func Test_canonicalizeURL(t *testing.T) {
+	for raw, expected := range canonicalURLTests {
+		actual, err := canonicalizeURL(raw)
+		if expected == "" {
+			assert.Equal(t, errorInvalidURL, err, "%q", raw)
+		} else {
+			assert.Nil(t, err, "%q", raw)
+			assert.Equal(t, expected, actual)
+		}
+	}
+}
+
+func Test_urlScheme(t *testing.T) {
+	for raw, expected := range urlSchemeTests {
+		assert.Equal(t, expected, urlScheme(raw), "%q", raw)
+	}
+}
+
+// Test_Clean_URLBypassVectors runs a corpus of known protocol filter bypasses, none of
+// which may survive cleaning, with and without scheme-relative URLs allowed
+func Test_Clean_URLBypassVectors(t *testing.T) {
+	cleaners := []Cleaner{
+		NewBasicCleanerWithImages(),
+		NewBasicCleanerWithImages().AllowSchemeRelative().AllowHosts("good.example"),
+	}
+
+	for _, c := range cleaners {
+		for _, vector := range urlBypassVectors {
+			actual, err := c.CleanString(`<a href="` + vector + `">x</a>`)
+			assert.Nil(t, err)
+			assert.Equal(t, `<a rel="nofollow">x</a>`, actual, "href %q", vector)
+
+			actual, err = c.CleanString(`<img src="` + vector + `">`)
+			assert.Nil(t, err)
+			assert.Equal(t, `<img/>`, actual, "src %q", vector)
+		}
+	}
+
+	// scheme-relative URLs to allowed hosts are only kept when allowed
+	actual, err := cleaners[0].CleanString(`<img src="//good.example/a.png">`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<img/>`, actual)
+	actual, err = cleaners[1].CleanString(`<img src="//good.example/a.png">`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<img src="//good.example/a.png"/>`, actual)
+}
+
+func Test_Clean_SpecialSchemeVectors(t *testing.T) {
+	hosts := NewBasicCleanerWithImages().AllowHosts("good.example")
+	links := NewBasicCleaner().WithLinkPolicy(LinkPolicy{InternalHosts: []string{"good.example"}})
+	rewrite := CamoRewriter("https://camo.example", []byte("secret"))
+	rewriter := NewBasicCleanerWithImages().RewriteURLs(rewrite)
+
+	for vector, normalized := range specialSchemeVectors {
+		actual, err := hosts.CleanString(`<a href="` + vector + `">x</a><img src="` + vector + `">`)
+		assert.Nil(t, err)
+		assert.Equal(t, `<a rel="nofollow">x</a><img/>`, actual, "host rules %q", vector)
+
+		actual, err = links.CleanString(`<a href="` + vector + `">x</a>`)
+		assert.Nil(t, err)
+		expected := `<a>x</a>`
+		if normalized != "" {
+			expected = `<a href="` + normalized + `" rel="nofollow ugc">x</a>`
+		}
+		assert.Equal(t, expected, actual, "link policy %q", vector)
+
+		actual, err = rewriter.CleanString(`<img src="` + vector + `">`)
+		assert.Nil(t, err)
+		expected = `<img/>`
+		if normalized != "" {
+			u, _ := url.Parse(normalized)
+			expected = `<img src="` + rewrite(atom.Img, "src", u) + `"/>`
+			assert.True(t, strings.HasPrefix(expected, `<img src="https://camo.example/`))
+		}
+		assert.Equal(t, expected, actual, "rewriter %q", vector)
+	}
+}
+
+func Test_normalizeURL(t *testing.T) {
+	for raw, expected := range normalizeURLTests {
+		u, err := url.Parse(raw)
+		assert.Nil(t, err)
+		normalizeURL(u, []string{"utm_*", "fbclid", "gclid"})
+		assert.Equal(t, expected, u.String())
+	}
+}
+
+func Test_Clean_NormalizeURLs(t *testing.T) {
+	c := NewBasicCleaner().NormalizeURLs().AddTags(T(atom.A, "href").AllowHosts("href", "xn--bcher-kva.example"))
+
+	actual, err := c.CleanString(`<a href="HTTPS://Bücher.example:443/?utm_source=x&amp;id=1&amp;fbclid=y">x</a>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<a href="https://xn--bcher-kva.example/?id=1">x</a>`, actual)
+
+	// explicit parameters replace the defaults
+	c = NewBasicCleaner().NormalizeURLs("Ref")
+	actual, err = c.CleanString(`<a href="http://example.com:80/?utm_source=x&amp;ref=y">x</a>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<a href="http://example.com/?utm_source=x" rel="nofollow">x</a>`, actual)
+
+	// URLs are left alone unless normalization is enabled
+	actual, err = NewBasicCleaner().CleanString(`<a href="http://EXAMPLE.com:80/?fbclid=y">x</a>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<a href="http://EXAMPLE.com:80/?fbclid=y" rel="nofollow">x</a>`, actual)
+}
+
+var normalizeURLTests = map[string]string{
+	"HTTP://EXAMPLE.COM:80/Path":                         "http://example.com/Path",
+	"https://example.com:443/":                           "https://example.com/",
+	"https://example.com:8443/":                          "https://example.com:8443/",
+	"ftp://example.com:21/f":                             "ftp://example.com/f",
+	"https://Bücher.example/":                            "https://xn--bcher-kva.example/",
+	"https://[::1]:443/":                                 "https://[::1]/",
+	"https://[::1]:8080/":                                "https://[::1]:8080/",
+	"https://example.com/?a=1&utm_source=x&b=2&fbclid=y": "https://example.com/?a=1&b=2",
+	"https://example.com/?UTM_Medium=x&gclid":            "https://example.com/",
+	"https://example.com/?utm%5Fsource=x&q=a+b%26c":      "https://example.com/?q=a+b%26c",
+	"https://example.com/?b=2&a=1#utm_source=x":          "https://example.com/?b=2&a=1#utm_source=x",
+	"/relative?utm_source=x&page=2":                      "/relative?page=2",
+	"mailto:someone@example.com?utm_source=x":            "mailto:someone@example.com?utm_source=x",
+}
+
+var canonicalURLTests = map[string]string{
+	"https://example.com/":        "https://example.com/",
+	"  https://example.com/ \n":   "https://example.com/",
+	"\x01\x1fjavascript:alert(1)": "javascript:alert(1)",
+	"java\tscr\nipt:alert(1)":     "javascript:alert(1)",
+	"/path?q=a\\b":                "/path?q=a\\b",
+	"/path#a\\b":                  "/path#a\\b",
+	"java\x00script:alert(1)":     "",
+	"java\x7fscript:alert(1)":     "",
+	"https:\\\\evil.example":      "",
+	"/\\evil.example":             "",
+	"https://example.com\\@evil/": "",
+}
+
+var urlSchemeTests = map[string]string{
+	"HTTPS://example.com": "https",
+	"javascript:x":        "javascript",
+	"a+b-c.d:x":           "a+b-c.d",
+	"/relative:x":         "",
+	"1http:x":             "",
+	":x":                  "",
+	"no-scheme":           "",
+	"path/to:x":           "",
+}
+
+// specialSchemeVectors maps http and https URLs that net/url parses without a host to
+// the form browsers resolve them to, or "" if they are rejected
+var specialSchemeVectors = map[string]string{
+	`http:evil.example`:   "http://evil.example",
+	`https:/evil.example`: "https://evil.example",
+	`HTTPS:evil.example`:  "https://evil.example",
+	`http:\\evil.example`: "",
+}
+
+var urlBypassVectors = []string{
+	"javascript:alert(1)",
+	"JaVaScRiPt:alert(1)",
+	" javascript:alert(1)",
+	"\x01javascript:alert(1)",
+	"java\tscript:alert(1)",
+	"java\nscript:alert(1)",
+	"java\rscript:alert(1)",
+	"javascript\t:alert(1)",
+	"&#106;avascript:alert(1)",
+	"&#x6A;avascript:alert(1)",
+	"&#0000106&#0000097&#0000118&#0000097&#0000115&#0000099&#0000114&#0000105&#0000112&#0000116&#0000058alert(1)",
+	"&#x6A&#x61&#x76&#x61&#x73&#x63&#x72&#x69&#x70&#x74&#x3A;alert(1)",
+	"&amp;#106;avascript:alert(1)",
+	"jav&#x09;ascript:alert(1)",
+	"jav&#x0A;ascript:alert(1)",
+	"jav&#x0D;ascript:alert(1)",
+	"javascript&colon;alert(1)",
+	"java\x00script:alert(1)",
+	"vbscript:msgbox(1)",
+	"data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==",
+	"livescript:alert(1)",
+	"//evil.example/x",
+	"\\\\evil.example/x",
+	"/\\evil.example/x",
+	"https:\\\\evil.example/x",
+	"http:/\\evil.example/x",
+}
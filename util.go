@@ -3,40 +3,132 @@ package gsoup
 import (
 	"strings"
 
+	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 )
 
 func cloneWhitelist(in whitelist) (out whitelist) {
 	out = make(map[atom.Atom]*Tagdef)
 	for tag, tagdef := range in {
-		newdef := &Tagdef{Tag: tagdef.Tag, AllowedAttrs: make(Attrset)}
-		for attr := range tagdef.AllowedAttrs {
-			newdef.AllowedAttrs[attr] = struct{}{}
+		out[tag] = cloneTagdef(tagdef)
+	}
+	return out
+}
+
+func cloneCustomWhitelist(in customWhitelist) (out customWhitelist) {
+	out = make(map[string]*Tagdef)
+	for name, tagdef := range in {
+		out[name] = cloneTagdef(tagdef)
+	}
+	return out
+}
+
+func cloneAttrset(in Attrset) (out Attrset) {
+	if in == nil {
+		return nil
+	}
+	out = make(Attrset)
+	for attr := range in {
+		out[attr] = struct{}{}
+	}
+	return out
+}
+
+func cloneProtoset(in Protoset) (out Protoset) {
+	if in == nil {
+		return nil
+	}
+	out = make(Protoset)
+	for proto := range in {
+		out[proto] = struct{}{}
+	}
+	return out
+}
+
+func cloneHostset(in Hostset) (out Hostset) {
+	if in == nil {
+		return nil
+	}
+	out = make(Hostset)
+	for host := range in {
+		out[host] = struct{}{}
+	}
+	return out
+}
+
+func cloneHostmap(in Hostmap) (out Hostmap) {
+	if in == nil {
+		return nil
+	}
+	out = make(Hostmap)
+	for attr, hosts := range in {
+		out[attr] = cloneHostset(hosts)
+	}
+	return out
+}
+
+func cloneTagdef(tagdef *Tagdef) *Tagdef {
+	newdef := &Tagdef{Tag: tagdef.Tag, Name: tagdef.Name, AllowedAttrs: make(Attrset), allowRelativeLinks: tagdef.allowRelativeLinks, dropOnHostViolation: tagdef.dropOnHostViolation}
+	for attr := range tagdef.AllowedAttrs {
+		newdef.AllowedAttrs[attr] = struct{}{}
+	}
+
+	// enforced attrs
+	for key, value := range tagdef.EnforcedAttrs {
+		if newdef.EnforcedAttrs == nil {
+			newdef.EnforcedAttrs = make(map[string]string)
 		}
+		newdef.EnforcedAttrs[key] = value
+	}
 
-		// enforced attrs
-		for key, value := range tagdef.EnforcedAttrs {
-			if newdef.EnforcedAttrs == nil {
-				newdef.EnforcedAttrs = make(map[string]string)
-			}
-			newdef.EnforcedAttrs[key] = value
+	// enforced protocols
+	for attr, protos := range tagdef.EnforcedProtocols {
+		if newdef.EnforcedProtocols == nil {
+			newdef.EnforcedProtocols = make(Protomap)
 		}
+		newdef.EnforcedProtocols[attr] = cloneProtoset(protos)
+	}
 
-		// enforced protocols
-		for attr, protos := range tagdef.EnforcedProtocols {
-			if newdef.EnforcedProtocols == nil {
-				newdef.EnforcedProtocols = make(Protomap)
-			}
-			protoset := make(Protoset)
-			for proto := range protos {
-				protoset[proto] = struct{}{}
-			}
-			newdef.EnforcedProtocols[attr] = protoset
+	// host rules
+	newdef.AllowedHosts = cloneHostmap(tagdef.AllowedHosts)
+	newdef.DeniedHosts = cloneHostmap(tagdef.DeniedHosts)
+
+	// data URI policies
+	for attr, policy := range tagdef.AllowedDataURIs {
+		if newdef.AllowedDataURIs == nil {
+			newdef.AllowedDataURIs = make(DataURImap)
 		}
+		policy.MediaTypes = append([]string(nil), policy.MediaTypes...)
+		newdef.AllowedDataURIs[attr] = policy
+	}
 
-		out[tag] = newdef
+	// validated attrs
+	for attr, validators := range tagdef.ValidatedAttrs {
+		if newdef.ValidatedAttrs == nil {
+			newdef.ValidatedAttrs = make(Validatormap)
+		}
+		newdef.ValidatedAttrs[attr] = append([]AttrValidator(nil), validators...)
 	}
-	return out
+
+	// allowed styles
+	for prop, validator := range tagdef.AllowedStyles {
+		if newdef.AllowedStyles == nil {
+			newdef.AllowedStyles = make(Stylemap)
+		}
+		newdef.AllowedStyles[prop] = validator
+	}
+
+	return newdef
+}
+
+// hasAttr reports whether n has an attribute with the given normalized key
+func hasAttr(n *html.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if normalizeAttrKey(attr.Key) == key {
+			return true
+		}
+	}
+	return false
 }
 
 func normalizeAttrKey(key string) string {
@@ -60,3 +152,8 @@ func normalizeProtocol(proto string) string {
 	}
 	return ""
 }
+
+// normalizeHost lowercases a host or host pattern and removes any trailing dot
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
@@ -13,7 +13,9 @@ func Test_cloneWhitelist(t *testing.T) {
 		atom.H1:  T(atom.H1, "class"),
 		atom.Div: T(atom.Div, "id", "class"),
 		atom.A:   T(atom.A).EnforceAttr("rel", "nofollow"),
-		atom.Img: T(atom.Img, "src").EnforceProtocols("src", "http"),
+		atom.Img: T(atom.Img, "src").EnforceProtocols("src", "http").AllowHosts("src", ".example.com").DenyHosts("src", "x.example.com").DropElementOnHostViolation(),
+		atom.Ol:  T(atom.Ol, "start").ValidateAttr("start", IntegerRange(1, 10)),
+		atom.Q:   T(atom.Q, "cite").EnforceProtocols("cite", "http").AllowRelativeLinks(),
 	}
 
 	w2 := cloneWhitelist(w1)
@@ -21,12 +23,15 @@ func Test_cloneWhitelist(t *testing.T) {
 
 	// manipulate w2
 	w2[atom.H2] = T(atom.H2, "onclick")
-	assert.Equal(t, 5, len(w2), "w2 should now have 5 tag defs")
-	assert.Equal(t, 4, len(w1), "w1 should still have 4 tag defs")
+	assert.Equal(t, 7, len(w2), "w2 should now have 7 tag defs")
+	assert.Equal(t, 6, len(w1), "w1 should still have 6 tag defs")
 
 	delete(w2[atom.Div].AllowedAttrs, "id")
 	_, present := w1[atom.Div].AllowedAttrs["id"]
 	assert.True(t, present, "w1's tagdef should not be mutable thought w2")
+
+	w2[atom.Ol].ValidateAttr("start", MaxLength(1))
+	assert.Equal(t, 1, len(w1[atom.Ol].ValidatedAttrs["start"]), "w1's validators should not be mutable through w2")
 }
 
 func Test_normalizeAttrKey(t *testing.T) {
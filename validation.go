@@ -0,0 +1,54 @@
+package gsoup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is returned when input violates a cleaner's rules, either from
+// Validate or from the Clean methods of a strict cleaner
+type ValidationError struct {
+	Violations []Removal
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		msgs[i] = violation.String()
+	}
+	noun := "violations"
+	if len(e.Violations) == 1 {
+		noun = "violation"
+	}
+	return fmt.Sprintf("gsoup: %d %s: %s", len(e.Violations), noun, strings.Join(msgs, "; "))
+}
+
+// String describes the removal, e.g. `attribute onclick="alert(1)" on html/body/p: not allowed`
+func (r Removal) String() string {
+	var desc string
+	switch r.Kind {
+	case RemovedElement:
+		desc = "element <" + r.Name + "> in " + r.Path
+	case RemovedAttribute:
+		desc = "attribute " + r.Name + "=" + strconv.Quote(r.Value) + " on " + r.Path
+	case RemovedStyle:
+		desc = "style " + strconv.Quote(r.Name+": "+r.Value) + " on " + r.Path
+	case RemovedComment:
+		desc = "comment in " + r.Path
+	default:
+		desc = r.Kind.String() + " in " + r.Path
+	}
+	if r.Path == "" {
+		desc = strings.TrimSuffix(strings.TrimSuffix(desc, " in "), " on ")
+	}
+	return desc + ": " + r.Reason.String()
+}
+
+// violations returns a *ValidationError if anything was removed, nil otherwise
+func (r *Report) violations() error {
+	if len(r.Removals) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: r.Removals}
+}
@@ -0,0 +1,112 @@
+package gsoup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func Test_Validate(t *testing.T) {
+	c := NewBasicCleaner()
+
+	err := c.Validate(strings.NewReader(`<p>fine <a href="http://google.com">link</a></p>`))
+	assert.Nil(t, err)
+
+	err = c.Validate(strings.NewReader(`<p onclick="alert(1)">x</p><div>y</div><a href="javascript:alert(1)">z</a>`))
+	verr, ok := err.(*ValidationError)
+	assert.True(t, ok, "error should be a *ValidationError")
+	assert.Equal(t, []Removal{
+		{Kind: RemovedAttribute, Reason: ReasonNotAllowed, Name: "onclick", Value: "alert(1)", Path: "html/body/p"},
+		{Kind: RemovedElement, Reason: ReasonNotAllowed, Name: "div", Path: "html/body"},
+		{Kind: RemovedAttribute, Reason: ReasonInvalidProtocol, Name: "href", Value: "javascript:alert(1)", Path: "html/body/a"},
+	}, verr.Violations)
+	assert.Equal(t, `gsoup: 3 violations: attribute onclick="alert(1)" on html/body/p: not allowed; `+
+		`element <div> in html/body: not allowed; `+
+		`attribute href="javascript:alert(1)" on html/body/a: invalid protocol`, err.Error())
+
+	err = c.Validate(badReader{})
+	assert.NotNil(t, err)
+	_, ok = err.(*ValidationError)
+	assert.False(t, ok, "parse errors should be returned as-is")
+}
+
+func Test_Validate_SkipsTransformers(t *testing.T) {
+	calls := 0
+	count := func(x XNode) XNode {
+		calls++
+		return x
+	}
+	c := NewEmptyCleaner().AddTags(T(atom.Strong))
+	c.AddTransformer(func(x XNode) XNode {
+		calls++
+		if x.Atom() == atom.B {
+			x.SetAtom(atom.Strong)
+		}
+		return x
+	})
+	c.AddPostTransformer(count)
+	c.AddFinalizer(func(x XNode) { calls++ })
+
+	input := `<strong>a</strong><b>b</b>`
+	err := c.Validate(strings.NewReader(input))
+	assert.Equal(t, "gsoup: 1 violation: element <b> in html/body: not allowed", err.Error())
+	assert.Equal(t, 0, calls)
+
+	actual, err := c.Strict().CleanString(input)
+	assert.Nil(t, err, "strict cleaning should still run transformers")
+	assert.Equal(t, `<strong>a</strong><strong>b</strong>`, actual)
+	assert.NotEqual(t, 0, calls)
+}
+
+func Test_Strict(t *testing.T) {
+	c := &cleaner{}
+	assert.False(t, c.strict, "default should be false")
+	c2 := c.Strict()
+	assert.True(t, c.strict)
+	assert.True(t, c2.(*cleaner).strict)
+}
+
+func Test_Strict_Clean(t *testing.T) {
+	c := NewBasicCleaner().Strict()
+
+	actual, err := c.CleanString(`<p>ok</p>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `<p>ok</p>`, actual)
+
+	doc, err := c.Clean(strings.NewReader(`<p>ok</p><!-- hi -->`))
+	assert.Nil(t, doc)
+	assert.Equal(t, "gsoup: 1 violation: comment in html/body: not allowed", err.Error())
+
+	actual, err = c.CleanString(`<p style="color: red">ok</p>`)
+	assert.Equal(t, "", actual)
+	assert.IsType(t, &ValidationError{}, err)
+
+	doc, report, err := c.CleanWithReport(strings.NewReader(`<script>alert(1)</script>`))
+	assert.Nil(t, doc)
+	assert.Equal(t, 1, len(report.Removals))
+	assert.IsType(t, &ValidationError{}, err)
+
+	root := &html.Node{Type: html.ElementNode, Data: "iframe", DataAtom: atom.Iframe}
+	doc, err = c.CleanNode(root)
+	assert.Nil(t, doc)
+	assert.Equal(t, "gsoup: 1 violation: element <iframe>: not allowed", err.Error())
+}
+
+func Test_Removal_String(t *testing.T) {
+	for expected, removal := range removalStrings {
+		assert.Equal(t, expected, removal.String())
+	}
+}
+
+var removalStrings = map[string]Removal{
+	`element <div> in html/body: not allowed`:                {Kind: RemovedElement, Reason: ReasonNotAllowed, Name: "div", Path: "html/body"},
+	`element <script> in div: ancestor removed`:              {Kind: RemovedElement, Reason: ReasonAncestorRemoved, Name: "script", Path: "div"},
+	`attribute href="/foo" on a: relative link`:              {Kind: RemovedAttribute, Reason: ReasonRelativeLink, Name: "href", Value: "/foo", Path: "a"},
+	`style "position: fixed" on p: unsafe style`:             {Kind: RemovedStyle, Reason: ReasonUnsafeStyle, Name: "position", Value: "fixed", Path: "p"},
+	`comment: not allowed`:                                   {Kind: RemovedComment, Reason: ReasonNotAllowed, Value: "hi"},
+	`doctype in html: not allowed`:                           {Kind: RemovedDoctype, Reason: ReasonNotAllowed, Value: "html", Path: "html"},
+	`attribute width="wide" on html/body/img: invalid value`: {Kind: RemovedAttribute, Reason: ReasonInvalidValue, Name: "width", Value: "wide", Path: "html/body/img"},
+}
@@ -0,0 +1,150 @@
+package gsoup
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AttrValidator validates the value of an element attribute. Attributes whose
+// values fail validation are removed during cleaning
+type AttrValidator interface {
+	Validate(value string) bool
+}
+
+// ValidatorFunc is an adapter that allows an ordinary function to be used as an AttrValidator
+type ValidatorFunc func(value string) bool
+
+// Validate calls f(value)
+func (f ValidatorFunc) Validate(value string) bool {
+	return f(value)
+}
+
+// MatchRegexp returns a validator that accepts values matched in their entirety by re
+func MatchRegexp(re *regexp.Regexp) AttrValidator {
+	return regexpValidator{re: regexp.MustCompile(`^(?:` + re.String() + `)$`)}
+}
+
+// OneOf returns a validator that accepts only the enumerated values. As with HTML's
+// enumerated attributes, comparison is ASCII case-insensitive
+func OneOf(values ...string) AttrValidator {
+	v := enumValidator{values: make(map[string]struct{})}
+	for _, value := range values {
+		v.values[strings.ToLower(value)] = struct{}{}
+	}
+	return v
+}
+
+// IntegerRange returns a validator that accepts integers between min and max (inclusive)
+func IntegerRange(min, max int) AttrValidator {
+	return intRangeValidator{min: min, max: max}
+}
+
+// MaxLength returns a validator that accepts values no longer than n bytes
+func MaxLength(n int) AttrValidator {
+	return maxLengthValidator{max: n}
+}
+
+// Color returns a validator that accepts hex colors (#rgb, #rgba, #rrggbb, #rrggbbaa),
+// CSS named colors and the rgb(), rgba(), hsl() and hsla() functional notations
+func Color() AttrValidator {
+	return colorValidator{}
+}
+
+// Dimension returns a validator that accepts HTML dimension values: a non-negative
+// number of pixels, optionally followed by a percent sign
+func Dimension() AttrValidator {
+	return dimensionValidator{}
+}
+
+type regexpValidator struct {
+	re *regexp.Regexp
+}
+
+func (v regexpValidator) Validate(value string) bool {
+	return v.re.MatchString(value)
+}
+
+type enumValidator struct {
+	values map[string]struct{}
+}
+
+func (v enumValidator) Validate(value string) bool {
+	_, ok := v.values[strings.ToLower(strings.TrimSpace(value))]
+	return ok
+}
+
+type intRangeValidator struct {
+	min, max int
+}
+
+func (v intRangeValidator) Validate(value string) bool {
+	i, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	return i >= v.min && i <= v.max
+}
+
+type maxLengthValidator struct {
+	max int
+}
+
+func (v maxLengthValidator) Validate(value string) bool {
+	return len(value) <= v.max
+}
+
+type colorValidator struct{}
+
+var hexColorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+var funcColorPattern = regexp.MustCompile(`^(?:rgba?|hsla?)\(\s*[0-9.]+%?\s*(?:,\s*[0-9.]+%?\s*){2,3}\)$`)
+
+func (v colorValidator) Validate(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if hexColorPattern.MatchString(value) || funcColorPattern.MatchString(value) {
+		return true
+	}
+	_, ok := namedColors[value]
+	return ok
+}
+
+type dimensionValidator struct{}
+
+var dimensionPattern = regexp.MustCompile(`^[0-9]{1,7}(?:\.[0-9]{1,4})?%?$`)
+
+func (v dimensionValidator) Validate(value string) bool {
+	return dimensionPattern.MatchString(strings.TrimSpace(value))
+}
+
+var namedColors = map[string]struct{}{
+	"aliceblue": {}, "antiquewhite": {}, "aqua": {}, "aquamarine": {}, "azure": {},
+	"beige": {}, "bisque": {}, "black": {}, "blanchedalmond": {}, "blue": {},
+	"blueviolet": {}, "brown": {}, "burlywood": {}, "cadetblue": {}, "chartreuse": {},
+	"chocolate": {}, "coral": {}, "cornflowerblue": {}, "cornsilk": {}, "crimson": {},
+	"cyan": {}, "darkblue": {}, "darkcyan": {}, "darkgoldenrod": {}, "darkgray": {},
+	"darkgreen": {}, "darkgrey": {}, "darkkhaki": {}, "darkmagenta": {}, "darkolivegreen": {},
+	"darkorange": {}, "darkorchid": {}, "darkred": {}, "darksalmon": {}, "darkseagreen": {},
+	"darkslateblue": {}, "darkslategray": {}, "darkslategrey": {}, "darkturquoise": {}, "darkviolet": {},
+	"deeppink": {}, "deepskyblue": {}, "dimgray": {}, "dimgrey": {}, "dodgerblue": {},
+	"firebrick": {}, "floralwhite": {}, "forestgreen": {}, "fuchsia": {}, "gainsboro": {},
+	"ghostwhite": {}, "gold": {}, "goldenrod": {}, "gray": {}, "green": {},
+	"greenyellow": {}, "grey": {}, "honeydew": {}, "hotpink": {}, "indianred": {},
+	"indigo": {}, "ivory": {}, "khaki": {}, "lavender": {}, "lavenderblush": {},
+	"lawngreen": {}, "lemonchiffon": {}, "lightblue": {}, "lightcoral": {}, "lightcyan": {},
+	"lightgoldenrodyellow": {}, "lightgray": {}, "lightgreen": {}, "lightgrey": {}, "lightpink": {},
+	"lightsalmon": {}, "lightseagreen": {}, "lightskyblue": {}, "lightslategray": {}, "lightslategrey": {},
+	"lightsteelblue": {}, "lightyellow": {}, "lime": {}, "limegreen": {}, "linen": {},
+	"magenta": {}, "maroon": {}, "mediumaquamarine": {}, "mediumblue": {}, "mediumorchid": {},
+	"mediumpurple": {}, "mediumseagreen": {}, "mediumslateblue": {}, "mediumspringgreen": {}, "mediumturquoise": {},
+	"mediumvioletred": {}, "midnightblue": {}, "mintcream": {}, "mistyrose": {}, "moccasin": {},
+	"navajowhite": {}, "navy": {}, "oldlace": {}, "olive": {}, "olivedrab": {},
+	"orange": {}, "orangered": {}, "orchid": {}, "palegoldenrod": {}, "palegreen": {},
+	"paleturquoise": {}, "palevioletred": {}, "papayawhip": {}, "peachpuff": {}, "peru": {},
+	"pink": {}, "plum": {}, "powderblue": {}, "purple": {}, "rebeccapurple": {},
+	"red": {}, "rosybrown": {}, "royalblue": {}, "saddlebrown": {}, "salmon": {},
+	"sandybrown": {}, "seagreen": {}, "seashell": {}, "sienna": {}, "silver": {},
+	"skyblue": {}, "slateblue": {}, "slategray": {}, "slategrey": {}, "snow": {},
+	"springgreen": {}, "steelblue": {}, "tan": {}, "teal": {}, "thistle": {},
+	"tomato": {}, "turquoise": {}, "violet": {}, "wheat": {}, "white": {},
+	"whitesmoke": {}, "yellow": {}, "yellowgreen": {}, "transparent": {},
+}
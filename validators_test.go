@@ -0,0 +1,72 @@
+package gsoup
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidatorFunc(t *testing.T) {
+	v := ValidatorFunc(func(value string) bool { return value == "ok" })
+	assert.True(t, v.Validate("ok"))
+	assert.False(t, v.Validate("nope"))
+}
+
+func Test_MatchRegexp(t *testing.T) {
+	v := MatchRegexp(regexp.MustCompile(`[a-z]+|[0-9]+`))
+	assert.True(t, v.Validate("abc"))
+	assert.True(t, v.Validate("123"))
+	assert.False(t, v.Validate("abc123"), "regexp must match the entire value")
+	assert.False(t, v.Validate("javascript:abc"), "regexp must match the entire value")
+	assert.False(t, v.Validate(""))
+}
+
+func Test_OneOf(t *testing.T) {
+	v := OneOf("row", "Col")
+	assert.True(t, v.Validate("row"))
+	assert.True(t, v.Validate("ROW"), "comparison should be case-insensitive")
+	assert.True(t, v.Validate(" col "))
+	assert.False(t, v.Validate("rowgroup"))
+	assert.False(t, v.Validate(""))
+}
+
+func Test_IntegerRange(t *testing.T) {
+	v := IntegerRange(1, 10)
+	assert.True(t, v.Validate("1"))
+	assert.True(t, v.Validate("10"))
+	assert.True(t, v.Validate(" 5 "))
+	assert.False(t, v.Validate("0"))
+	assert.False(t, v.Validate("11"))
+	assert.False(t, v.Validate("5.5"))
+	assert.False(t, v.Validate("javascript:alert(1)"))
+	assert.False(t, v.Validate(strings.Repeat("9", 100)))
+}
+
+func Test_MaxLength(t *testing.T) {
+	v := MaxLength(3)
+	assert.True(t, v.Validate(""))
+	assert.True(t, v.Validate("abc"))
+	assert.False(t, v.Validate("abcd"))
+}
+
+func Test_Color(t *testing.T) {
+	v := Color()
+	for _, valid := range []string{"#fff", "#FFFA", "#a0b1c2", "#a0b1c2ff", "red", "RebeccaPurple", "rgb(1, 2, 3)", "rgba(1,2,3,0.5)", "hsl(120, 50%, 50%)"} {
+		assert.True(t, v.Validate(valid), "%s should be a valid color", valid)
+	}
+	for _, invalid := range []string{"", "#ff", "#gggggg", "notacolor", "url(javascript:alert(1))", "rgb(1,2)", "expression(alert(1))"} {
+		assert.False(t, v.Validate(invalid), "%s should not be a valid color", invalid)
+	}
+}
+
+func Test_Dimension(t *testing.T) {
+	v := Dimension()
+	for _, valid := range []string{"0", "100", "50%", "12.5", "12.5%", " 10 "} {
+		assert.True(t, v.Validate(valid), "%s should be a valid dimension", valid)
+	}
+	for _, invalid := range []string{"", "-1", "10px", "%", "1e10", "javascript:alert(1)", strings.Repeat("1", 100)} {
+		assert.False(t, v.Validate(invalid), "%s should not be a valid dimension", invalid)
+	}
+}
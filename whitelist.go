@@ -1,16 +1,119 @@
 package gsoup
 
-import "golang.org/x/net/html/atom"
+import (
+	"strings"
+
+	"golang.org/x/net/html/atom"
+)
 
 // Tagset encapsulates a set of unique HTML elements
 type Tagset map[atom.Atom]struct{}
 
-// Attrset encapsulates a set of unique element attributes
+// Attrset encapsulates a set of unique element attributes. Attributes may also be given
+// as wildcard patterns, where * matches any sequence of characters (e.g. "data-*").
+// Patterns never match event handlers, style, srcdoc or URL attributes
 type Attrset map[string]struct{}
 
+// allows reports whether the normalized attribute key is in the set, either by name or
+// by matching a wildcard pattern
+func (a Attrset) allows(key string) bool {
+	if _, ok := a[key]; ok {
+		return true
+	}
+	for pattern := range a {
+		if matchAttrPattern(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAttrPattern reports whether key matches a wildcard attribute pattern. Patterns never
+// match event handler attributes (e.g. onclick) or the attributes in unpatternedAttrs,
+// which must always be allowed by name
+func matchAttrPattern(pattern string, key string) bool {
+	if !strings.Contains(pattern, "*") || strings.HasPrefix(key, "on") {
+		return false
+	}
+	if _, ok := unpatternedAttrs[key]; ok {
+		return false
+	}
+	if _, ok := urlAttrs[key]; ok {
+		return false
+	}
+	return matchGlob(pattern, key)
+}
+
+// unpatternedAttrs are attributes that, like the URL attributes in urlAttrs, wildcard
+// patterns never match. Allowing them by name on a Tagdef is what applies its style rules
+// and protocol checks to them
+var unpatternedAttrs = Attrset{
+	"archive":  struct{}{},
+	"classid":  struct{}{},
+	"codebase": struct{}{},
+	"data":     struct{}{},
+	"dynsrc":   struct{}{},
+	"icon":     struct{}{},
+	"lowsrc":   struct{}{},
+	"manifest": struct{}{},
+	"ping":     struct{}{},
+	"profile":  struct{}{},
+	"srcdoc":   struct{}{},
+	"style":    struct{}{},
+}
+
+// matchGlob reports whether s matches pattern, where * matches any sequence of characters
+func matchGlob(pattern string, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
+
 // Protoset encapsulates a set of unique attribute value protocols
 type Protoset map[string]struct{}
 
+// Hostset encapsulates a set of host patterns. A pattern is an exact host name
+// ("example.com"), a domain and all of its subdomains (".example.com"), only the
+// subdomains of a domain ("*.example.com"), or any host ("*")
+type Hostset map[string]struct{}
+
+// matches reports whether the normalized host matches any pattern in the set
+func (h Hostset) matches(host string) bool {
+	for pattern := range h {
+		if matchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHost reports whether host matches a single host pattern
+func matchHost(pattern string, host string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return len(host) > len(pattern)-1 && strings.HasSuffix(host, pattern[1:])
+	case strings.HasPrefix(pattern, "."):
+		return host == pattern[1:] || strings.HasSuffix(host, pattern)
+	}
+	return host == pattern
+}
+
 // Attrmap encapsulates a map of unique element attributes and their values.
 // Values will be escaped when set on attributes
 type Attrmap map[string]string
@@ -18,21 +121,94 @@ type Attrmap map[string]string
 // Protomap encapsulates a set of protocols to be enforced on an attribute value
 type Protomap map[string]Protoset
 
+// Hostmap encapsulates the host patterns applied to URL attribute values
+type Hostmap map[string]Hostset
+
+// Validatormap encapsulates the validators to be applied to attribute values
+type Validatormap map[string][]AttrValidator
+
+// Stylemap encapsulates the CSS properties allowed in a style attribute and the
+// validators to be applied to their values. A nil validator only applies the
+// default value safety checks
+type Stylemap map[string]AttrValidator
+
 // Tagdef encapsulates a single element and its allowed attributes
 type Tagdef struct {
 	Tag               atom.Atom
+	Name              string // tag name of elements without an atom, i.e. custom elements
 	AllowedAttrs      Attrset
 	EnforcedAttrs     Attrmap
 	EnforcedProtocols Protomap
+	AllowedHosts      Hostmap
+	DeniedHosts       Hostmap
+	AllowedDataURIs   DataURImap
+	ValidatedAttrs    Validatormap
+	AllowedStyles     Stylemap
 
 	// allowRelativeLinks controls whether relative links should be permitted during
 	// protocol enforcement. Has no function on attr values where protocols are not
 	// enforced via a rule
 	allowRelativeLinks bool
+
+	// dropOnHostViolation controls whether an element is removed, rather than just the
+	// offending attribute, when a URL's host is not allowed
+	dropOnHostViolation bool
 }
 
 type whitelist map[atom.Atom]*Tagdef
 
+// customWhitelist holds tagdefs for custom elements, keyed by tag name
+type customWhitelist map[string]*Tagdef
+
+// reservedElementNames are hyphenated SVG and MathML names that may not be used by custom elements
+var reservedElementNames = map[string]struct{}{
+	"annotation-xml":   struct{}{},
+	"color-profile":    struct{}{},
+	"font-face":        struct{}{},
+	"font-face-src":    struct{}{},
+	"font-face-uri":    struct{}{},
+	"font-face-format": struct{}{},
+	"font-face-name":   struct{}{},
+	"missing-glyph":    struct{}{},
+}
+
+// validCustomElementName reports whether name is a valid custom element name: it must
+// begin with a lowercase ASCII letter, contain a hyphen, contain no uppercase ASCII
+// letters and not be a reserved name
+func validCustomElementName(name string) bool {
+	if name == "" || name[0] < 'a' || name[0] > 'z' || !strings.Contains(name, "-") {
+		return false
+	}
+	if _, reserved := reservedElementNames[name]; reserved {
+		return false
+	}
+	for _, r := range name {
+		if !isPCENChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isPCENChar reports whether r may appear in a custom element name
+func isPCENChar(r rune) bool {
+	switch {
+	case r == '-' || r == '.' || r == '_' || r == 0xB7:
+		return true
+	case r >= '0' && r <= '9', r >= 'a' && r <= 'z':
+		return true
+	case r >= 0xC0 && r <= 0xD6, r >= 0xD8 && r <= 0xF6, r >= 0xF8 && r <= 0x37D, r >= 0x37F && r <= 0x1FFF:
+		return true
+	case r >= 0x200C && r <= 0x200D, r >= 0x203F && r <= 0x2040, r >= 0x2070 && r <= 0x218F:
+		return true
+	case r >= 0x2C00 && r <= 0x2FEF, r >= 0x3001 && r <= 0xD7FF, r >= 0xF900 && r <= 0xFDCF:
+		return true
+	case r >= 0xFDF0 && r <= 0xFFFD, r >= 0x10000 && r <= 0xEFFFF:
+		return true
+	}
+	return false
+}
+
 // EnforceAttr marks an attribute as enforced for a tag. Any tags encountered by the
 // parser will have the attribute key and value applied to them.
 func (t *Tagdef) EnforceAttr(key string, value string) *Tagdef {
@@ -69,3 +245,98 @@ func (t *Tagdef) AllowRelativeLinks() *Tagdef {
 	t.allowRelativeLinks = true
 	return t
 }
+
+// AllowHosts restricts URLs in the given attr to hosts matching the patterns (only
+// applies to the receiver's tag). These take the place of any hosts allowed by the
+// cleaner. Relative URLs have no host and are unaffected
+func (t *Tagdef) AllowHosts(attr string, hosts ...string) *Tagdef {
+	if t.AllowedHosts == nil {
+		t.AllowedHosts = make(Hostmap)
+	}
+	attr = normalizeAttrKey(attr)
+	t.AllowedHosts[attr] = addHosts(t.AllowedHosts[attr], hosts)
+	return t
+}
+
+// DenyHosts rejects URLs in the given attr with hosts matching the patterns (only
+// applies to the receiver's tag). Denied hosts take precedence over allowed hosts
+func (t *Tagdef) DenyHosts(attr string, hosts ...string) *Tagdef {
+	if t.DeniedHosts == nil {
+		t.DeniedHosts = make(Hostmap)
+	}
+	attr = normalizeAttrKey(attr)
+	t.DeniedHosts[attr] = addHosts(t.DeniedHosts[attr], hosts)
+	return t
+}
+
+// AllowDataURIs allows data: URIs satisfying the policy in the given attr (only applies
+// to the receiver's tag), regardless of the protocols otherwise enforced on it
+func (t *Tagdef) AllowDataURIs(attr string, policy DataURIPolicy) *Tagdef {
+	if t.AllowedDataURIs == nil {
+		t.AllowedDataURIs = make(DataURImap)
+	}
+	policy.MediaTypes = append([]string(nil), policy.MediaTypes...)
+	t.AllowedDataURIs[normalizeAttrKey(attr)] = policy
+	return t
+}
+
+// DropElementOnHostViolation causes elements with a URL whose host is not allowed to be
+// removed entirely, rather than just the offending attribute. Default: false
+func (t *Tagdef) DropElementOnHostViolation() *Tagdef {
+	t.dropOnHostViolation = true
+	return t
+}
+
+// addHosts adds normalized host patterns to hostset, creating it if necessary
+func addHosts(hostset Hostset, hosts []string) Hostset {
+	if hostset == nil {
+		hostset = make(Hostset)
+	}
+	for _, host := range hosts {
+		host = normalizeHost(host)
+		if host != "" {
+			hostset[host] = struct{}{}
+		}
+	}
+	return hostset
+}
+
+// ValidateAttr adds a validator for the given attr (only applies to the receiver's tag).
+// Attributes with values that fail any of their validators will be removed
+func (t *Tagdef) ValidateAttr(attr string, validator AttrValidator) *Tagdef {
+	if validator == nil {
+		return t
+	}
+	if t.ValidatedAttrs == nil {
+		t.ValidatedAttrs = make(Validatormap)
+	}
+	attr = normalizeAttrKey(attr)
+	t.ValidatedAttrs[attr] = append(t.ValidatedAttrs[attr], validator)
+	return t
+}
+
+// AllowStyles allows the style attribute on the receiver's tag, retaining only the
+// listed CSS properties. Values of well-known properties are validated by built-in
+// rules, and all values are rejected if they contain url(), expression(), escapes or
+// other constructs capable of loading resources or executing script
+func (t *Tagdef) AllowStyles(props ...string) *Tagdef {
+	for _, prop := range props {
+		prop = strings.ToLower(strings.TrimSpace(prop))
+		t.AllowStyle(prop, cssPropertyValidators[prop])
+	}
+	return t
+}
+
+// AllowStyle allows a single CSS property in the receiver's style attribute, with
+// values checked by the given validator in addition to the default safety checks
+func (t *Tagdef) AllowStyle(prop string, validator AttrValidator) *Tagdef {
+	if t.AllowedAttrs == nil {
+		t.AllowedAttrs = make(Attrset)
+	}
+	t.AllowedAttrs["style"] = struct{}{}
+	if t.AllowedStyles == nil {
+		t.AllowedStyles = make(Stylemap)
+	}
+	t.AllowedStyles[strings.ToLower(strings.TrimSpace(prop))] = validator
+	return t
+}
@@ -57,3 +57,105 @@ func Test_AllowRelativeLinks(t *testing.T) {
 	tdef.AllowRelativeLinks()
 	assert.True(t, tdef.allowRelativeLinks)
 }
+
+func Test_ValidateAttr(t *testing.T) {
+	tdef := T(atom.Ol, "start")
+
+	tdef2 := tdef.ValidateAttr("START", IntegerRange(1, 10))
+	assert.Equal(t, tdef, tdef2, "returned value from factory patter should equal receiver")
+	assert.Equal(t, 1, len(tdef.ValidatedAttrs["start"]), "tagdef should lowercase attr keys")
+
+	tdef.ValidateAttr("start", MaxLength(1)).ValidateAttr("start", nil)
+	assert.Equal(t, 2, len(tdef.ValidatedAttrs["start"]), "validators should accumulate and ignore nil")
+}
+
+func Test_AllowStyles(t *testing.T) {
+	tdef := &Tagdef{Tag: atom.P}
+
+	tdef2 := tdef.AllowStyles("COLOR", "x-unknown")
+	assert.Equal(t, tdef, tdef2, "returned value from factory patter should equal receiver")
+	_, ok := tdef.AllowedAttrs["style"]
+	assert.True(t, ok, "style attribute should be allowed")
+	assert.Equal(t, cssPropertyValidators["color"], tdef.AllowedStyles["color"], "known properties should use built-in validators")
+	validator, ok := tdef.AllowedStyles["x-unknown"]
+	assert.True(t, ok, "unknown properties should be allowed")
+	assert.Nil(t, validator, "unknown properties should have no validator")
+
+	tdef.AllowStyle("width", OneOf("10px"))
+	assert.Equal(t, OneOf("10px"), tdef.AllowedStyles["width"])
+}
+
+func Test_validCustomElementName(t *testing.T) {
+	for _, name := range []string{"x-mention", "my-embed", "a-", "x-1.2_3", "emotion-😍", "math-α"} {
+		assert.True(t, validCustomElementName(name), "%s should be valid", name)
+	}
+	for _, name := range []string{"", "div", "-x", "1-x", "X-mention", "x-Mention", "x mention", "x-<script>", "font-face", "annotation-xml"} {
+		assert.False(t, validCustomElementName(name), "%s should not be valid", name)
+	}
+}
+
+func Test_matchGlob(t *testing.T) {
+	for pattern, matches := range globTests {
+		for s, expected := range matches {
+			assert.Equal(t, expected, matchGlob(pattern, s), "matchGlob(%q, %q)", pattern, s)
+		}
+	}
+}
+
+func Test_Attrset_allows(t *testing.T) {
+	attrs := T(atom.Div, "id", "data-*", "aria-*", "*-label").AllowedAttrs
+
+	assert.True(t, attrs.allows("id"))
+	assert.True(t, attrs.allows("data-user"))
+	assert.True(t, attrs.allows("aria-hidden"))
+	assert.True(t, attrs.allows("x-label"))
+	assert.False(t, attrs.allows("class"))
+	assert.False(t, attrs.allows("data"))
+
+	attrs = T(atom.Div, "*", "o*").AllowedAttrs
+	assert.True(t, attrs.allows("title"))
+	assert.False(t, attrs.allows("onclick"), "patterns should never match event handlers")
+	assert.False(t, attrs.allows("onmouseover"), "patterns should never match event handlers")
+	for _, key := range []string{"style", "srcdoc", "src", "srcset", "href", "xlink:href", "formaction", "data", "ping"} {
+		assert.False(t, attrs.allows(key), "patterns should never match %s", key)
+	}
+	assert.False(t, T(atom.P, "s*").AllowedAttrs.allows("style"))
+	assert.True(t, T(atom.P, "s*").AllowedAttrs.allows("span"))
+	assert.True(t, T(atom.P, "s*", "style").AllowedAttrs.allows("style"), "attributes may still be allowed by name")
+
+	var nilset Attrset
+	assert.False(t, nilset.allows("id"))
+}
+
+func Test_AllowHosts_DenyHosts(t *testing.T) {
+	tdef := T(atom.A, "href").AllowHosts("HREF", " Example.COM. ", "", "*.cdn.example").DenyHosts("href", "evil.example")
+	assert.True(t, reflect.DeepEqual(tdef.AllowedHosts, Hostmap{"href": Hostset{"example.com": struct{}{}, "*.cdn.example": struct{}{}}}))
+	assert.True(t, reflect.DeepEqual(tdef.DeniedHosts, Hostmap{"href": Hostset{"evil.example": struct{}{}}}))
+	assert.False(t, tdef.dropOnHostViolation)
+
+	tdef.DropElementOnHostViolation()
+	assert.True(t, tdef.dropOnHostViolation)
+}
+
+func Test_matchHost(t *testing.T) {
+	for pattern, matches := range hostTests {
+		for host, expected := range matches {
+			assert.Equal(t, expected, matchHost(pattern, host), "matchHost(%q, %q)", pattern, host)
+		}
+	}
+}
+
+var hostTests = map[string]map[string]bool{
+	"example.com":   {"example.com": true, "www.example.com": false, "badexample.com": false},
+	".example.com":  {"example.com": true, "www.example.com": true, "a.b.example.com": true, "badexample.com": false},
+	"*.example.com": {"example.com": false, "www.example.com": true, "a.b.example.com": true, "badexample.com": false, ".example.com": false},
+	"*":             {"example.com": true, "localhost": true},
+}
+
+var globTests = map[string]map[string]bool{
+	"data-*":  {"data-": true, "data-x": true, "data-x-y": true, "data": false, "xdata-x": false},
+	"*-label": {"-label": true, "aria-label": true, "aria-labelledby": false},
+	"a*b*c":   {"abc": true, "aXbYc": true, "abbc": true, "ab": false, "acb": false, "abcx": false},
+	"*":       {"": true, "anything": true},
+	"exact":   {"exact": true, "exactexact": false, "": false},
+}